@@ -4,37 +4,73 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
+	"strconv"
 )
 
+// ErrInvalidPadding 填充数据不正确，通常是密钥、IV不正确或密文被篡改
+var ErrInvalidPadding = errors.New("填充数据不正确")
+
 // 加密 AES-128。key长度：16, 24, 32 bytes 对应 AES-128, AES-192, AES-256
 func AESEncode(key, iv, plainText []byte) (string, error) {
-	block, err := aes.NewCipher(key)
+	cipherData, err := aesCBCEncrypt(key, iv, plainText)
 	if err != nil {
 		return "", err
 	}
-	blockSize := block.BlockSize()
-	plainText = PKCS5Padding(plainText, blockSize)
-	blockMode := cipher.NewCBCEncrypter(block, iv)
-	cipherData := make([]byte, len(plainText))
-	blockMode.CryptBlocks(cipherData, plainText)
 	return hex.EncodeToString(cipherData), nil
 }
 
-// AES解密
+// AES解密，密钥、IV或密文不正确时返回错误
+// CBC模式不能发现密文被篡改，需要防篡改时使用AESEncodeWithMAC或AES-GCM
 func AESDecode(key, iv []byte, cipherText string) (string, error) {
 	cipherData, err := hex.DecodeString(cipherText)
 	if err != nil {
 		return "", err
 	}
-	block, err := aes.NewCipher(key)
+	origData, err := aesCBCDecrypt(key, iv, cipherData)
+	if err != nil {
+		return "", err
+	}
+	return bytesToStr(origData), nil
+}
+
+// AES加密后使用HMAC-SHA256对IV和密文签名（encrypt-then-MAC），返回Hex(密文 || 签名)
+// macKey不能与key相同
+func AESEncodeWithMAC(key, macKey, iv, plainText []byte) (string, error) {
+	if len(macKey) == 0 {
+		return "", errors.New("macKey不能为空")
+	}
+	cipherData, err := aesCBCEncrypt(key, iv, plainText)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(append(cipherData, cbcMAC(macKey, iv, cipherData)...)), nil
+}
+
+// 校验AESEncodeWithMAC生成的签名后解密，签名不正确时返回ErrAuthFailed且不会解密
+func AESDecodeWithMAC(key, macKey, iv []byte, cipherText string) (string, error) {
+	if len(macKey) == 0 {
+		return "", errors.New("macKey不能为空")
+	}
+	data, err := hex.DecodeString(cipherText)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < sha256.Size {
+		return "", ErrAuthFailed
+	}
+	cipherData, sign := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(sign, cbcMAC(macKey, iv, cipherData)) {
+		return "", ErrAuthFailed
+	}
+	origData, err := aesCBCDecrypt(key, iv, cipherData)
 	if err != nil {
 		return "", err
 	}
-	blockMode := cipher.NewCBCDecrypter(block, iv)
-	origData := make([]byte, len(cipherData))
-	blockMode.CryptBlocks(origData, cipherData)
-	origData = PKCS5UnPadding(origData)
 	return bytesToStr(origData), nil
 }
 
@@ -45,9 +81,77 @@ func PKCS5Padding(plainText []byte, blockSize int) []byte {
 	return append(plainText, padtext...)
 }
 
-// 去除填充
+// 去除填充，填充数据不正确时返回nil
+// 只检查最后一个字节，需要完整校验时使用PKCS7UnPadding
 func PKCS5UnPadding(origData []byte) []byte {
 	length := len(origData)
+	if length == 0 {
+		return nil
+	}
 	unpadding := int(origData[length-1])
+	if unpadding == 0 || unpadding > length {
+		return nil
+	}
 	return origData[:(length - unpadding)]
 }
+
+// 校验并去除PKCS#7填充，校验所有填充字节且耗时与填充内容无关
+func PKCS7UnPadding(origData []byte, blockSize int) ([]byte, error) {
+	length := len(origData)
+	if blockSize <= 0 || blockSize > 255 || length == 0 || length%blockSize != 0 {
+		return nil, ErrInvalidPadding
+	}
+	padding := int(origData[length-1])
+	good := subtle.ConstantTimeLessOrEq(1, padding) & subtle.ConstantTimeLessOrEq(padding, blockSize)
+	// 检查最后一个分组中的所有字节，属于填充的字节必须等于padding
+	for i := 1; i <= blockSize; i++ {
+		inPadding := subtle.ConstantTimeLessOrEq(i, padding)
+		equal := subtle.ConstantTimeByteEq(origData[length-i], byte(padding))
+		good &= subtle.ConstantTimeSelect(inPadding, equal, 1)
+	}
+	if good != 1 {
+		return nil, ErrInvalidPadding
+	}
+	return origData[:length-padding], nil
+}
+
+// aesCBCEncrypt 校验参数后使用CBC模式加密
+func aesCBCEncrypt(key, iv, plainText []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("IV长度必须为" + strconv.Itoa(block.BlockSize()))
+	}
+	// 复制明文，避免append修改调用方的数据
+	plainText = PKCS5Padding(append([]byte(nil), plainText...), block.BlockSize())
+	cipherData := make([]byte, len(plainText))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(cipherData, plainText)
+	return cipherData, nil
+}
+
+// aesCBCDecrypt 校验参数后使用CBC模式解密并去除填充
+func aesCBCDecrypt(key, iv, cipherData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("IV长度必须为" + strconv.Itoa(block.BlockSize()))
+	}
+	if len(cipherData) == 0 || len(cipherData)%block.BlockSize() != 0 {
+		return nil, errors.New("密文长度必须为" + strconv.Itoa(block.BlockSize()) + "的倍数")
+	}
+	origData := make([]byte, len(cipherData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(origData, cipherData)
+	return PKCS7UnPadding(origData, block.BlockSize())
+}
+
+// cbcMAC 使用HMAC-SHA256计算IV和密文的签名
+func cbcMAC(macKey, iv, cipherData []byte) []byte {
+	h := NewSHA256(macKey)
+	_, _ = h.Write(iv)
+	_, _ = h.Write(cipherData)
+	return h.Sum(nil)
+}
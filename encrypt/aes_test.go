@@ -0,0 +1,143 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+)
+
+var (
+	aesTestKey    = []byte("0123456789abcdef")
+	aesTestMACKey = []byte("fedcba9876543210")
+	aesTestIV     = []byte("abcdef0123456789")
+)
+
+func TestPKCS7UnPadding(t *testing.T) {
+	block := func(tail ...byte) []byte {
+		return append(bytes.Repeat([]byte{'a'}, 16-len(tail)), tail...)
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		expected []byte // nil表示应返回ErrInvalidPadding
+	}{
+		{name: "填充1字节", data: block(1), expected: bytes.Repeat([]byte{'a'}, 15)},
+		{name: "填充3字节", data: block(3, 3, 3), expected: bytes.Repeat([]byte{'a'}, 13)},
+		{name: "整个分组都是填充", data: append(block(1), bytes.Repeat([]byte{16}, 16)...), expected: block(1)},
+		{name: "填充为0", data: block(0)},
+		{name: "填充超出分组大小", data: block(17)},
+		{name: "填充字节不一致", data: block(2, 3, 3)},
+		{name: "填充超出数据长度", data: bytes.Repeat([]byte{16}, 15)},
+		{name: "长度不是分组的倍数", data: block(1)[:15]},
+		{name: "空数据"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origData, err := PKCS7UnPadding(tt.data, 16)
+			if tt.expected == nil {
+				if err != ErrInvalidPadding {
+					t.Fatal("应返回ErrInvalidPadding", err)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(origData, tt.expected) {
+				t.Fatal("去除填充的结果不正确", origData, err)
+			}
+		})
+	}
+	if _, err := PKCS7UnPadding(block(1), 0); err != ErrInvalidPadding {
+		t.Fatal("分组大小为0时应返回ErrInvalidPadding", err)
+	}
+	if PKCS5UnPadding(block(0)) != nil || PKCS5UnPadding(nil) != nil {
+		t.Fatal("PKCS5UnPadding在填充不正确时应返回nil")
+	}
+}
+
+func TestAESDecode(t *testing.T) {
+	for _, plain := range []string{"", "a", "0123456789abcdef", "0123456789abcdef0"} {
+		cipherText, err := AESEncode(aesTestKey, aesTestIV, []byte(plain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := AESDecode(aesTestKey, aesTestIV, cipherText)
+		if err != nil || decrypted != plain {
+			t.Fatal("解密结果不正确", decrypted, err)
+		}
+	}
+
+	// 解密后填充不正确的密文
+	block, err := aes.NewCipher(aesTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badPadding := make([]byte, 16)
+	cipher.NewCBCEncrypter(block, aesTestIV).CryptBlocks(badPadding, append(bytes.Repeat([]byte{'a'}, 15), 0))
+
+	tests := []struct {
+		name       string
+		key        []byte
+		iv         []byte
+		cipherText string
+	}{
+		{name: "填充不正确", key: aesTestKey, iv: aesTestIV, cipherText: hex.EncodeToString(badPadding)},
+		{name: "密文为空", key: aesTestKey, iv: aesTestIV, cipherText: ""},
+		{name: "长度不是分组的倍数", key: aesTestKey, iv: aesTestIV, cipherText: hex.EncodeToString(badPadding[:15])},
+		{name: "Hex格式不正确", key: aesTestKey, iv: aesTestIV, cipherText: "zz"},
+		{name: "IV长度不正确", key: aesTestKey, iv: aesTestIV[:8], cipherText: hex.EncodeToString(badPadding)},
+		{name: "密钥长度不正确", key: aesTestKey[:5], iv: aesTestIV, cipherText: hex.EncodeToString(badPadding)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AESDecode(tt.key, tt.iv, tt.cipherText); err == nil {
+				t.Fatal("应返回错误")
+			}
+		})
+	}
+	if _, err := AESDecode(aesTestKey, aesTestIV, hex.EncodeToString(badPadding)); err != ErrInvalidPadding {
+		t.Fatal("填充不正确时应返回ErrInvalidPadding", err)
+	}
+}
+
+func TestAESDecodeWithMAC(t *testing.T) {
+	cipherText, err := AESEncodeWithMAC(aesTestKey, aesTestMACKey, aesTestIV, []byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := AESDecodeWithMAC(aesTestKey, aesTestMACKey, aesTestIV, cipherText)
+	if err != nil || decrypted != "hello world" {
+		t.Fatal("解密结果不正确", decrypted, err)
+	}
+
+	data, _ := hex.DecodeString(cipherText)
+	tamper := func(i int) string {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 1
+		return hex.EncodeToString(tampered)
+	}
+	tests := []struct {
+		name       string
+		macKey     []byte
+		iv         []byte
+		cipherText string
+	}{
+		{name: "修改密文", macKey: aesTestMACKey, iv: aesTestIV, cipherText: tamper(0)},
+		{name: "修改签名", macKey: aesTestMACKey, iv: aesTestIV, cipherText: tamper(len(data) - 1)},
+		{name: "IV不同", macKey: aesTestMACKey, iv: []byte("9876543210fedcba"), cipherText: cipherText},
+		{name: "macKey不同", macKey: aesTestKey, iv: aesTestIV, cipherText: cipherText},
+		{name: "删除签名", macKey: aesTestMACKey, iv: aesTestIV, cipherText: hex.EncodeToString(data[:len(data)-32])},
+		{name: "只有签名", macKey: aesTestMACKey, iv: aesTestIV, cipherText: hex.EncodeToString(data[len(data)-32:])},
+		{name: "长度不足", macKey: aesTestMACKey, iv: aesTestIV, cipherText: hex.EncodeToString(data[:31])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AESDecodeWithMAC(aesTestKey, tt.macKey, tt.iv, tt.cipherText); err != ErrAuthFailed {
+				t.Fatal("应返回ErrAuthFailed", err)
+			}
+		})
+	}
+	if _, err = AESDecodeWithMAC(aesTestKey, nil, aesTestIV, cipherText); err == nil {
+		t.Fatal("macKey为空时应返回错误")
+	}
+}
@@ -0,0 +1,110 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// AES-GCM密文格式的版本号，密文格式为：版本号(1字节) || nonce(12字节) || 密文 || tag(16字节)
+// 标准库不包含ChaCha20-Poly1305，因此只提供AES-GCM
+const GCMVersion byte = 1
+
+var (
+	// ErrUnsupportedVersion 密文的版本号不受支持
+	ErrUnsupportedVersion = errors.New("不支持的密文版本")
+	// ErrAuthFailed 密文或附加数据被篡改，或者密钥不正确
+	ErrAuthFailed = errors.New("密文校验失败")
+)
+
+// newGCM 创建AES-GCM，key长度：16, 24, 32 bytes 对应 AES-128, AES-192, AES-256
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AES-GCM加密，每次使用随机的nonce，additionalData为附加验证数据（不加密，但解密时必须相同），可为nil
+func AESGCMEncrypt(key, plainText, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 1+gcm.NonceSize(), 1+gcm.NonceSize()+len(plainText)+gcm.Overhead())
+	out[0] = GCMVersion
+	nonce := out[1:]
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	// 版本号也作为附加验证数据，防止被修改
+	return gcm.Seal(out, nonce, plainText, gcmAdditionalData(out[0], additionalData)), nil
+}
+
+// AES-GCM解密，密文被篡改、附加数据不同或密钥不正确时返回ErrAuthFailed
+func AESGCMDecrypt(key, cipherData, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherData) < 1+gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("密文长度不正确")
+	}
+	if cipherData[0] != GCMVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	nonce := cipherData[1 : 1+gcm.NonceSize()]
+	plainText, err := gcm.Open(nil, nonce, cipherData[1+gcm.NonceSize():], gcmAdditionalData(cipherData[0], additionalData))
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plainText, nil
+}
+
+// AES-GCM加密并转为Hex字符串
+func AESGCMEncryptToHex(key, plainText, additionalData []byte) (string, error) {
+	cipherData, err := AESGCMEncrypt(key, plainText, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(cipherData), nil
+}
+
+// 解密Hex字符串格式的AES-GCM密文
+func AESGCMDecryptHex(key []byte, cipherText string, additionalData []byte) ([]byte, error) {
+	cipherData, err := hex.DecodeString(cipherText)
+	if err != nil {
+		return nil, err
+	}
+	return AESGCMDecrypt(key, cipherData, additionalData)
+}
+
+// AES-GCM加密并转为Base64字符串
+func AESGCMEncryptToBase64(key, plainText, additionalData []byte) (string, error) {
+	cipherData, err := AESGCMEncrypt(key, plainText, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cipherData), nil
+}
+
+// 解密Base64字符串格式的AES-GCM密文
+func AESGCMDecryptBase64(key []byte, cipherText string, additionalData []byte) ([]byte, error) {
+	cipherData, err := base64.RawURLEncoding.DecodeString(cipherText)
+	if err != nil {
+		return nil, err
+	}
+	return AESGCMDecrypt(key, cipherData, additionalData)
+}
+
+// gcmAdditionalData 在附加验证数据前加上版本号
+func gcmAdditionalData(version byte, additionalData []byte) []byte {
+	data := make([]byte, 0, 1+len(additionalData))
+	data = append(data, version)
+	return append(data, additionalData...)
+}
@@ -0,0 +1,100 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+var gcmTestKey = []byte("0123456789abcdef")
+
+func TestAESGCM(t *testing.T) {
+	for _, plain := range [][]byte{nil, []byte("a"), bytes.Repeat([]byte("0123456789"), 10)} {
+		cipherData, err := AESGCMEncrypt(gcmTestKey, plain, []byte("user:1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := AESGCMDecrypt(gcmTestKey, cipherData, []byte("user:1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Fatal("解密结果不正确", decrypted)
+		}
+	}
+
+	// 相同的明文每次加密的结果不同
+	c1, _ := AESGCMEncrypt(gcmTestKey, []byte("a"), nil)
+	c2, _ := AESGCMEncrypt(gcmTestKey, []byte("a"), nil)
+	if bytes.Equal(c1, c2) {
+		t.Fatal("nonce没有随机生成")
+	}
+
+	hexText, err := AESGCMEncryptToHex(gcmTestKey, []byte("hex"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := AESGCMDecryptHex(gcmTestKey, hexText, nil); err != nil || string(decrypted) != "hex" {
+		t.Fatal("Hex解密失败", err)
+	}
+	base64Text, err := AESGCMEncryptToBase64(gcmTestKey, []byte("base64"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := AESGCMDecryptBase64(gcmTestKey, base64Text, nil); err != nil || string(decrypted) != "base64" {
+		t.Fatal("Base64解密失败", err)
+	}
+}
+
+func TestAESGCMTamper(t *testing.T) {
+	cipherData, err := AESGCMEncrypt(gcmTestKey, []byte("hello world"), []byte("user:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 修改版本号之后的任意字节（nonce、密文、tag）都应校验失败
+	for i := 1; i < len(cipherData); i++ {
+		tampered := append([]byte(nil), cipherData...)
+		tampered[i] ^= 1
+		if _, err = AESGCMDecrypt(gcmTestKey, tampered, []byte("user:1")); err != ErrAuthFailed {
+			t.Fatal("修改第", i, "字节后应返回ErrAuthFailed", err)
+		}
+	}
+	tampered := append([]byte(nil), cipherData...)
+	tampered[0]++
+	if _, err = AESGCMDecrypt(gcmTestKey, tampered, []byte("user:1")); err != ErrUnsupportedVersion {
+		t.Fatal("修改版本号后应返回ErrUnsupportedVersion", err)
+	}
+
+	tests := []struct {
+		name           string
+		key            []byte
+		cipherData     []byte
+		additionalData []byte
+		expected       error
+	}{
+		{name: "附加数据不同", key: gcmTestKey, cipherData: cipherData, additionalData: []byte("user:2"), expected: ErrAuthFailed},
+		{name: "缺少附加数据", key: gcmTestKey, cipherData: cipherData, expected: ErrAuthFailed},
+		{name: "密钥错误", key: []byte("fedcba9876543210"), cipherData: cipherData, additionalData: []byte("user:1"), expected: ErrAuthFailed},
+		{name: "截断tag", key: gcmTestKey, cipherData: cipherData[:len(cipherData)-1], additionalData: []byte("user:1"), expected: ErrAuthFailed},
+		{name: "追加数据", key: gcmTestKey, cipherData: append(append([]byte(nil), cipherData...), 0), additionalData: []byte("user:1"), expected: ErrAuthFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AESGCMDecrypt(tt.key, tt.cipherData, tt.additionalData); err != tt.expected {
+				t.Fatal("应返回", tt.expected, "实际为", err)
+			}
+		})
+	}
+
+	// 长度不足或参数错误时返回错误且不会panic
+	for _, data := range [][]byte{nil, {GCMVersion}, cipherData[:1+12+15]} {
+		if _, err = AESGCMDecrypt(gcmTestKey, data, nil); err == nil {
+			t.Fatal("密文长度不正确时应返回错误", len(data))
+		}
+	}
+	if _, err = AESGCMDecrypt([]byte("short"), cipherData, nil); err == nil {
+		t.Fatal("密钥长度不正确时应返回错误")
+	}
+	if _, err = AESGCMDecryptHex(gcmTestKey, "zz", nil); err == nil {
+		t.Fatal("Hex格式不正确时应返回错误")
+	}
+}
@@ -0,0 +1,133 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 密码哈希的参数，哈希字符串格式为：pbkdf2-sha256$迭代次数$Base64(salt)$Base64(哈希值)
+const (
+	PasswordAlgorithm  = "pbkdf2-sha256"
+	PasswordIterations = 600000 // 默认的迭代次数
+	passwordSaltSize   = 16
+	passwordKeySize    = 32
+)
+
+var errInvalidPasswordHash = errors.New("无效的密码哈希")
+
+// PBKDF2-HMAC-SHA256密钥派生，keyLen为派生的密钥长度（字节）
+func PBKDF2(password, salt []byte, iterations, keyLen int) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("password不能为空")
+	}
+	if iterations <= 0 || keyLen <= 0 {
+		return nil, errors.New("迭代次数和密钥长度必须大于0")
+	}
+	prf := NewSHA256(password)
+	blocks := (keyLen + sha256.Size - 1) / sha256.Size
+	key := make([]byte, 0, blocks*sha256.Size)
+	var (
+		buf [4]byte
+		u   []byte
+	)
+	t := make([]byte, sha256.Size)
+	for block := 1; block <= blocks; block++ {
+		// U1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		_, _ = prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		_, _ = prf.Write(buf[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		// Un = PRF(password, Un-1)，T = U1 ^ U2 ^ ... ^ Un
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			_, _ = prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen], nil
+}
+
+// 生成密码哈希字符串，包含算法、迭代次数、随机salt和哈希值，iterations留空则使用PasswordIterations
+func HashPassword(password string, iterations ...int) (string, error) {
+	iter := passwordIterations(iterations)
+	salt := make([]byte, passwordSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	key, err := PBKDF2([]byte(password), salt, iter, passwordKeySize)
+	if err != nil {
+		return "", err
+	}
+	return PasswordAlgorithm + "$" + strconv.Itoa(iter) + "$" +
+		base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(key), nil
+}
+
+// 校验密码是否与HashPassword生成的哈希字符串匹配，哈希字符串格式不正确时返回错误
+func VerifyPassword(password, encoded string) (bool, error) {
+	iter, salt, key, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	if password == "" {
+		return false, nil
+	}
+	derived, err := PBKDF2([]byte(password), salt, iter, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
+
+// 判断哈希字符串是否需要使用当前的参数重新生成（算法不同、迭代次数较少或格式不正确），
+// 通常在用户登录且VerifyPassword成功后检查，iterations留空则使用PasswordIterations
+func NeedsRehash(encoded string, iterations ...int) bool {
+	iter, salt, key, err := parsePasswordHash(encoded)
+	if err != nil {
+		return true
+	}
+	return iter < passwordIterations(iterations) || len(salt) < passwordSaltSize || len(key) != passwordKeySize
+}
+
+// parsePasswordHash 解析密码哈希字符串
+func parsePasswordHash(encoded string) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != PasswordAlgorithm {
+		err = errInvalidPasswordHash
+		return
+	}
+	if iterations, err = strconv.Atoi(parts[1]); err != nil || iterations <= 0 {
+		err = errInvalidPasswordHash
+		return
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		err = errInvalidPasswordHash
+		return
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(key) == 0 {
+		err = errInvalidPasswordHash
+		return
+	}
+	return
+}
+
+// passwordIterations 获得迭代次数参数
+func passwordIterations(iterations []int) int {
+	if len(iterations) > 0 && iterations[0] > 0 {
+		return iterations[0]
+	}
+	return PasswordIterations
+}
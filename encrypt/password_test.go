@@ -0,0 +1,111 @@
+package encrypt
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 7914 第11节的PBKDF2-HMAC-SHA256测试向量
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		expected       string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		// 密钥长度不是摘要长度的整数倍
+		{"passwd", "salt", 1, 20, "55ac046e56e3089fec1691c22544b605f9418521"},
+	}
+	for _, tt := range tests {
+		key, err := PBKDF2([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(key) != tt.expected {
+			t.Fatal(tt.password, "派生的密钥不正确", hex.EncodeToString(key))
+		}
+	}
+
+	if _, err := PBKDF2(nil, []byte("salt"), 1, 32); err == nil {
+		t.Fatal("password为空时应返回错误")
+	}
+	if _, err := PBKDF2([]byte("passwd"), []byte("salt"), 0, 32); err == nil {
+		t.Fatal("迭代次数为0时应返回错误")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	encoded, err := HashPassword("password", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		ok       bool
+		err      bool
+	}{
+		{name: "正确", password: "password", encoded: encoded, ok: true},
+		{name: "错误", password: "Password", encoded: encoded},
+		{name: "空密码", password: "", encoded: encoded},
+		// salt为"0123456789abcdef"，迭代1000次
+		{name: "已知哈希", password: "password", encoded: "pbkdf2-sha256$1000$MDEyMzQ1Njc4OWFiY2RlZg$hRRjgXWkW8ResfIvBP99J/T4vkgEmMRV/0tJTOjR59I", ok: true},
+		{name: "短salt", password: "password", encoded: "pbkdf2-sha256$1000$c2FsdA$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", ok: true},
+		{name: "空字符串", password: "password", encoded: "", err: true},
+		{name: "段数不足", password: "password", encoded: "pbkdf2-sha256$1000$c2FsdA", err: true},
+		{name: "段数过多", password: "password", encoded: encoded + "$x", err: true},
+		{name: "算法不同", password: "password", encoded: "pbkdf2-sha1$1000$c2FsdA$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", err: true},
+		{name: "迭代次数为0", password: "password", encoded: "pbkdf2-sha256$0$c2FsdA$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", err: true},
+		{name: "迭代次数为负数", password: "password", encoded: "pbkdf2-sha256$-1$c2FsdA$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", err: true},
+		{name: "迭代次数不是数字", password: "password", encoded: "pbkdf2-sha256$abc$c2FsdA$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", err: true},
+		{name: "salt格式错误", password: "password", encoded: "pbkdf2-sha256$1000$!!!$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", err: true},
+		{name: "哈希值为空", password: "password", encoded: "pbkdf2-sha256$1000$c2FsdA$", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := VerifyPassword(tt.password, tt.encoded)
+			if (err != nil) != tt.err {
+				t.Fatal("错误不正确", err)
+			}
+			if ok != tt.ok {
+				t.Fatal("校验结果应为", tt.ok)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	encoded, err := HashPassword("password", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		encoded    string
+		iterations int
+		expected   bool
+	}{
+		{name: "参数相同", encoded: encoded, iterations: 1000},
+		{name: "迭代次数较多", encoded: encoded, iterations: 500},
+		{name: "迭代次数较少", encoded: encoded, iterations: 2000, expected: true},
+		{name: "低于默认迭代次数", encoded: encoded, expected: true},
+		{name: "短salt", encoded: "pbkdf2-sha256$1000$c2FsdA$YywoEuRtRgQQK6dhjp1tfS+BKPYma0oDJk0qBGC33LM", iterations: 1000, expected: true},
+		{name: "哈希值长度不同", encoded: "pbkdf2-sha256$1000$MDEyMzQ1Njc4OWFiY2RlZg$hRRjgXWkW8ResfIvBP99Jw", iterations: 1000, expected: true},
+		{name: "格式错误", encoded: "pbkdf2-sha256$1000", iterations: 1000, expected: true},
+		{name: "算法不同", encoded: "bcrypt$1000$MDEyMzQ1Njc4OWFiY2RlZg$hRRjgXWkW8ResfIvBP99J/T4vkgEmMRV/0tJTOjR59I", iterations: 1000, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var iterations []int
+			if tt.iterations > 0 {
+				iterations = append(iterations, tt.iterations)
+			}
+			if NeedsRehash(tt.encoded, iterations...) != tt.expected {
+				t.Fatal("应为", tt.expected)
+			}
+		})
+	}
+}
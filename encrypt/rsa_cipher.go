@@ -0,0 +1,201 @@
+package encrypt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// RSASignScheme RSA签名方案
+type RSASignScheme uint8
+
+const (
+	RSAPKCS1v15SHA256 RSASignScheme = iota + 1 // PKCS#1 v1.5，SHA-256
+	RSAPKCS1v15SHA512                          // PKCS#1 v1.5，SHA-512
+	RSAPSSSHA256                               // PSS，SHA-256
+	RSAPSSSHA512                               // PSS，SHA-512，salt长度等于摘要长度，密钥长度至少为1040位
+)
+
+// RSA-OAEP(SHA-256)加密，明文超出单次加密的长度时分段加密，密文为各段密文依次拼接
+// label为可选的标签，解密时必须相同，可为nil
+func RSAEncrypt(publicKey *rsa.PublicKey, plainText, label []byte) ([]byte, error) {
+	if publicKey == nil {
+		return nil, errors.New("无效的公钥")
+	}
+	// OAEP每段明文的最大长度
+	chunkSize := publicKey.Size() - 2*sha256.Size - 2
+	if chunkSize <= 0 {
+		return nil, errors.New("公钥长度不足")
+	}
+	cipherData := make([]byte, 0, (len(plainText)/chunkSize+1)*publicKey.Size())
+	for {
+		chunk := plainText
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, chunk, label)
+		if err != nil {
+			return nil, err
+		}
+		cipherData = append(cipherData, encrypted...)
+		plainText = plainText[len(chunk):]
+		if len(plainText) == 0 {
+			return cipherData, nil
+		}
+	}
+}
+
+// RSA-OAEP(SHA-256)解密，支持RSAEncrypt分段加密的密文
+func RSADecrypt(privateKey *rsa.PrivateKey, cipherData, label []byte) ([]byte, error) {
+	if privateKey == nil {
+		return nil, errors.New("无效的私钥")
+	}
+	size := privateKey.Size()
+	if len(cipherData) == 0 || len(cipherData)%size != 0 {
+		return nil, errors.New("密文长度不正确")
+	}
+	plainText := make([]byte, 0, len(cipherData))
+	for len(cipherData) > 0 {
+		decrypted, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, cipherData[:size], label)
+		if err != nil {
+			return nil, err
+		}
+		plainText = append(plainText, decrypted...)
+		cipherData = cipherData[size:]
+	}
+	return plainText, nil
+}
+
+// RSA加密并转为Base64字符串
+func RSAEncryptToBase64(publicKey *rsa.PublicKey, plainText, label []byte) (string, error) {
+	cipherData, err := RSAEncrypt(publicKey, plainText, label)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cipherData), nil
+}
+
+// RSA加密并转为Hex字符串
+func RSAEncryptToHex(publicKey *rsa.PublicKey, plainText, label []byte) (string, error) {
+	cipherData, err := RSAEncrypt(publicKey, plainText, label)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(cipherData), nil
+}
+
+// 解密Base64字符串格式的RSA密文
+func RSADecryptBase64(privateKey *rsa.PrivateKey, cipherText string, label []byte) ([]byte, error) {
+	cipherData, err := base64.RawURLEncoding.DecodeString(cipherText)
+	if err != nil {
+		return nil, err
+	}
+	return RSADecrypt(privateKey, cipherData, label)
+}
+
+// 解密Hex字符串格式的RSA密文
+func RSADecryptHex(privateKey *rsa.PrivateKey, cipherText string, label []byte) ([]byte, error) {
+	cipherData, err := hex.DecodeString(cipherText)
+	if err != nil {
+		return nil, err
+	}
+	return RSADecrypt(privateKey, cipherData, label)
+}
+
+// RSA签名，data为原始数据，按scheme计算摘要后签名
+func RSASign(privateKey *rsa.PrivateKey, data []byte, scheme RSASignScheme) ([]byte, error) {
+	if privateKey == nil {
+		return nil, errors.New("无效的私钥")
+	}
+	hash, pss, err := scheme.params()
+	if err != nil {
+		return nil, err
+	}
+	digest := hashData(hash, data)
+	if pss {
+		return rsa.SignPSS(rand.Reader, privateKey, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return rsa.SignPKCS1v15(rand.Reader, privateKey, hash, digest)
+}
+
+// RSA验签，签名正确时返回nil
+func RSAVerify(publicKey *rsa.PublicKey, data, sign []byte, scheme RSASignScheme) error {
+	if publicKey == nil {
+		return errors.New("无效的公钥")
+	}
+	hash, pss, err := scheme.params()
+	if err != nil {
+		return err
+	}
+	digest := hashData(hash, data)
+	if pss {
+		return rsa.VerifyPSS(publicKey, hash, digest, sign, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	}
+	return rsa.VerifyPKCS1v15(publicKey, hash, digest, sign)
+}
+
+// RSA签名并转为Base64字符串
+func RSASignToBase64(privateKey *rsa.PrivateKey, data []byte, scheme RSASignScheme) (string, error) {
+	sign, err := RSASign(privateKey, data, scheme)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sign), nil
+}
+
+// RSA签名并转为Hex字符串
+func RSASignToHex(privateKey *rsa.PrivateKey, data []byte, scheme RSASignScheme) (string, error) {
+	sign, err := RSASign(privateKey, data, scheme)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sign), nil
+}
+
+// 使用Base64字符串格式的签名验签
+func RSAVerifyBase64(publicKey *rsa.PublicKey, data []byte, sign string, scheme RSASignScheme) error {
+	signData, err := base64.RawURLEncoding.DecodeString(sign)
+	if err != nil {
+		return err
+	}
+	return RSAVerify(publicKey, data, signData, scheme)
+}
+
+// 使用Hex字符串格式的签名验签
+func RSAVerifyHex(publicKey *rsa.PublicKey, data []byte, sign string, scheme RSASignScheme) error {
+	signData, err := hex.DecodeString(sign)
+	if err != nil {
+		return err
+	}
+	return RSAVerify(publicKey, data, signData, scheme)
+}
+
+// params 获得签名方案的摘要算法和是否使用PSS
+func (scheme RSASignScheme) params() (crypto.Hash, bool, error) {
+	switch scheme {
+	case RSAPKCS1v15SHA256:
+		return crypto.SHA256, false, nil
+	case RSAPKCS1v15SHA512:
+		return crypto.SHA512, false, nil
+	case RSAPSSSHA256:
+		return crypto.SHA256, true, nil
+	case RSAPSSSHA512:
+		return crypto.SHA512, true, nil
+	}
+	return 0, false, errors.New("不支持的签名方案")
+}
+
+// hashData 计算摘要
+func hashData(hash crypto.Hash, data []byte) []byte {
+	if hash == crypto.SHA512 {
+		sum := sha512.Sum512(data)
+		return sum[:]
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,149 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func generateTestKey(t *testing.T, bits int) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func TestRSAEncrypt(t *testing.T) {
+	privateKey := generateTestKey(t, 2048)
+	publicKey := &privateKey.PublicKey
+	// OAEP(SHA-256)每段明文的最大长度
+	chunkSize := publicKey.Size() - 2*32 - 2
+	label := []byte("label")
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		plain := bytes.Repeat([]byte{'a'}, size)
+		cipherData, err := RSAEncrypt(publicKey, plain, label)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		chunks := (size + chunkSize - 1) / chunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		if len(cipherData) != chunks*publicKey.Size() {
+			t.Fatal(size, "密文长度不正确", len(cipherData))
+		}
+		decrypted, err := RSADecrypt(privateKey, cipherData, label)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Fatal(size, "解密结果不正确")
+		}
+	}
+
+	cipherData, err := RSAEncrypt(publicKey, bytes.Repeat([]byte{'a'}, chunkSize+1), label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte(nil), cipherData...)
+	tampered[publicKey.Size()+1] ^= 1
+	tests := []struct {
+		name       string
+		cipherData []byte
+		label      []byte
+	}{
+		{name: "标签不同", cipherData: cipherData, label: []byte("other")},
+		{name: "缺少标签", cipherData: cipherData},
+		{name: "修改第2段密文", cipherData: tampered, label: label},
+		{name: "截断", cipherData: cipherData[:len(cipherData)-1], label: label},
+		{name: "空密文", label: label},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := RSADecrypt(privateKey, tt.cipherData, tt.label); err == nil {
+				t.Fatal("应返回错误")
+			}
+		})
+	}
+
+	base64Text, err := RSAEncryptToBase64(publicKey, []byte("base64"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := RSADecryptBase64(privateKey, base64Text, nil); err != nil || string(decrypted) != "base64" {
+		t.Fatal("Base64解密失败", err)
+	}
+	hexText, err := RSAEncryptToHex(publicKey, []byte("hex"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := RSADecryptHex(privateKey, hexText, nil); err != nil || string(decrypted) != "hex" {
+		t.Fatal("Hex解密失败", err)
+	}
+	if _, err = RSAEncrypt(nil, []byte("a"), nil); err == nil {
+		t.Fatal("公钥为nil时应返回错误")
+	}
+}
+
+func TestRSASign(t *testing.T) {
+	privateKey := generateTestKey(t, 2048)
+	publicKey := &privateKey.PublicKey
+	data := []byte("hello world")
+
+	for _, scheme := range []RSASignScheme{RSAPKCS1v15SHA256, RSAPKCS1v15SHA512, RSAPSSSHA256, RSAPSSSHA512} {
+		sign, err := RSASign(privateKey, data, scheme)
+		if err != nil {
+			t.Fatal(scheme, err)
+		}
+		if err = RSAVerify(publicKey, data, sign, scheme); err != nil {
+			t.Fatal(scheme, "验签失败", err)
+		}
+		if err = RSAVerify(publicKey, []byte("hello World"), sign, scheme); err == nil {
+			t.Fatal(scheme, "数据被修改时应验签失败")
+		}
+		tampered := append([]byte(nil), sign...)
+		tampered[0] ^= 1
+		if err = RSAVerify(publicKey, data, tampered, scheme); err == nil {
+			t.Fatal(scheme, "签名被修改时应验签失败")
+		}
+
+		base64Sign, err := RSASignToBase64(privateKey, data, scheme)
+		if err != nil {
+			t.Fatal(scheme, err)
+		}
+		if err = RSAVerifyBase64(publicKey, data, base64Sign, scheme); err != nil {
+			t.Fatal(scheme, "Base64签名验签失败", err)
+		}
+		hexSign, err := RSASignToHex(privateKey, data, scheme)
+		if err != nil {
+			t.Fatal(scheme, err)
+		}
+		if err = RSAVerifyHex(publicKey, data, hexSign, scheme); err != nil {
+			t.Fatal(scheme, "Hex签名验签失败", err)
+		}
+	}
+
+	// 签名方案不同时验签失败
+	sign, err := RSASign(privateKey, data, RSAPKCS1v15SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []RSASignScheme{RSAPKCS1v15SHA512, RSAPSSSHA256} {
+		if err = RSAVerify(publicKey, data, sign, scheme); err == nil {
+			t.Fatal(scheme, "签名方案不同时应验签失败")
+		}
+	}
+	if _, err = RSASign(privateKey, data, 0); err == nil {
+		t.Fatal("不支持的签名方案应返回错误")
+	}
+	if err = RSAVerify(publicKey, data, sign, 0); err == nil {
+		t.Fatal("不支持的签名方案应返回错误")
+	}
+	// PSS-SHA512需要至少1040位的密钥
+	if _, err = RSASign(generateTestKey(t, 1024), data, RSAPSSSHA512); err == nil {
+		t.Fatal("密钥长度不足时应返回错误")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"hash"
+	"io"
 )
 
 // 从[]byte生成md5密文
@@ -145,3 +146,21 @@ func SHA256ByStr(data string, salt ...string) (cipher string, err error) {
 	cipher = hex.EncodeToString(h.Sum(nil))
 	return
 }
+
+// 创建sha256哈希，指定salt时使用HMAC，可用于边读取数据流边计算
+func NewSHA256(salt ...[]byte) hash.Hash {
+	if len(salt) > 0 && len(salt[0]) > 0 {
+		return hmac.New(sha256.New, salt[0])
+	}
+	return sha256.New()
+}
+
+// 根据io.Reader生成sha256密文
+func SHA256ByReader(r io.Reader, salt ...[]byte) (cipher string, err error) {
+	h := NewSHA256(salt...)
+	if _, err = io.Copy(h, r); err != nil {
+		return
+	}
+	cipher = hex.EncodeToString(h.Sum(nil))
+	return
+}
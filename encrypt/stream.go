@@ -0,0 +1,242 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// 流式加密的格式：
+// 头部：版本号(1字节) || 分段大小(4字节) || salt(16字节) || nonce前缀(7字节)
+// 每个数据流使用HMAC-SHA256(key, salt)派生的子密钥加密，同一密钥加密大量数据流时nonce也不会重复
+// 之后是依次加密的分段，除最后一段外每段明文长度都等于分段大小，每段密文比明文多16字节的tag
+// 每段的nonce为：nonce前缀 || 分段序号(4字节) || 是否为最后一段(1字节)，头部作为每段的附加验证数据，
+// 因此分段被删除、调换顺序或在分段边界处截断时都会解密失败
+const (
+	StreamVersion          byte = 1
+	DefaultStreamChunkSize      = 64 * 1024
+	maxStreamChunkSize          = 16 * 1024 * 1024
+	streamSaltSize              = 16
+	streamNoncePrefixSize       = 7
+	streamHeaderSize            = 1 + 4 + streamSaltSize + streamNoncePrefixSize
+)
+
+var errStreamClosed = errors.New("数据流已关闭")
+
+type (
+	// streamWriter 加密数据流
+	streamWriter struct {
+		writer  io.Writer
+		aead    cipher.AEAD
+		header  []byte
+		buf     []byte // 待加密的明文
+		out     []byte // 加密后的分段
+		counter uint32
+		err     error
+	}
+	// streamReader 解密数据流
+	streamReader struct {
+		reader  io.Reader
+		aead    cipher.AEAD
+		header  []byte
+		buf     []byte // 读取的密文，多读1字节用于判断是否为最后一段
+		pending int    // buf中已读取但未解密的字节数
+		out     []byte // 解密后的分段
+		plain   []byte // out中未被读取的明文
+		counter uint32
+		final   bool
+		err     error
+	}
+)
+
+// NewEncryptWriter 创建加密数据流，写入的数据使用AES-GCM分段加密后写入w，内存占用与数据大小无关
+// 必须调用Close写入最后一段，Close不会关闭w。chunkSize为分段大小，0则为64KB
+func NewEncryptWriter(w io.Writer, key []byte, chunkSize ...int) (io.WriteCloser, error) {
+	size := DefaultStreamChunkSize
+	if len(chunkSize) > 0 && chunkSize[0] > 0 {
+		size = chunkSize[0]
+	}
+	if size > maxStreamChunkSize {
+		return nil, errors.New("分段大小超出限制")
+	}
+	header := make([]byte, streamHeaderSize)
+	header[0] = StreamVersion
+	binary.BigEndian.PutUint32(header[1:5], uint32(size))
+	if _, err := io.ReadFull(rand.Reader, header[5:]); err != nil {
+		return nil, err
+	}
+	aead, err := streamGCM(key, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		writer: w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, size),
+		out:    make([]byte, 0, size+aead.Overhead()),
+	}, nil
+}
+
+// Write 写入明文，缓冲区满且还有后续数据时才加密，保证最后一段在Close时写入
+func (s *streamWriter) Write(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	for len(p) > 0 {
+		if len(s.buf) == cap(s.buf) {
+			if err = s.seal(false); err != nil {
+				return
+			}
+		}
+		c := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return
+}
+
+// Close 加密并写入最后一段
+func (s *streamWriter) Close() error {
+	if s.err != nil {
+		if s.err == errStreamClosed {
+			return nil
+		}
+		return s.err
+	}
+	if err := s.seal(true); err != nil {
+		return err
+	}
+	s.err = errStreamClosed
+	return nil
+}
+
+// seal 加密缓冲区中的明文并写入
+func (s *streamWriter) seal(final bool) error {
+	if s.counter == math.MaxUint32 {
+		s.err = errors.New("数据流的分段数量超出限制")
+		return s.err
+	}
+	s.out = s.aead.Seal(s.out[:0], streamNonce(s.header, s.counter, final), s.buf, s.header)
+	if _, err := s.writer.Write(s.out); err != nil {
+		s.err = err
+		return err
+	}
+	s.counter++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// NewDecryptReader 创建解密数据流，读取NewEncryptWriter生成的密文，
+// 密文被篡改或截断时返回ErrAuthFailed，只有读到io.EOF时数据才是完整的
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	// 先校验密钥，避免密钥错误时读取数据
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrAuthFailed
+		}
+		return nil, err
+	}
+	if header[0] != StreamVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	size := binary.BigEndian.Uint32(header[1:5])
+	if size == 0 || size > maxStreamChunkSize {
+		return nil, errors.New("分段大小不正确")
+	}
+	aead, err := streamGCM(key, header)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		reader: r,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, int(size)+aead.Overhead()+1),
+		out:    make([]byte, 0, size),
+	}, nil
+}
+
+// Read 读取解密后的明文
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.final {
+			s.err = io.EOF
+			return 0, io.EOF
+		}
+		s.err = s.open()
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// open 读取并解密一个分段
+func (s *streamReader) open() error {
+	n, err := io.ReadFull(s.reader, s.buf[s.pending:])
+	n += s.pending
+	switch err {
+	case nil:
+		// 读满时后面还有数据，当前分段不是最后一段
+	case io.EOF, io.ErrUnexpectedEOF:
+		s.final = true
+	default:
+		return err
+	}
+	chunkLen := n
+	if !s.final {
+		chunkLen = n - 1
+	}
+	if s.counter == math.MaxUint32 {
+		return errors.New("数据流的分段数量超出限制")
+	}
+	plain, err := s.aead.Open(s.out[:0], streamNonce(s.header, s.counter, s.final), s.buf[:chunkLen], s.header)
+	if err != nil {
+		return ErrAuthFailed
+	}
+	s.counter++
+	s.plain = plain
+	// 多读的1字节是下一段的开头
+	s.pending = 0
+	if !s.final {
+		s.buf[0] = s.buf[n-1]
+		s.pending = 1
+	}
+	return nil
+}
+
+// streamGCM 使用头部中的salt派生数据流的子密钥，子密钥长度与key相同
+func streamGCM(key, header []byte) (cipher.AEAD, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	h := NewSHA256(key)
+	_, _ = h.Write(header[5 : 5+streamSaltSize])
+	return newGCM(h.Sum(nil)[:len(key)])
+}
+
+// streamNonce 生成分段的nonce
+func streamNonce(header []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[streamHeaderSize-streamNoncePrefixSize:])
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,167 @@
+package encrypt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+var streamTestKey = []byte("0123456789abcdef0123456789abcdef")
+
+func encryptStream(t *testing.T, plain []byte, chunkSize int) []byte {
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, streamTestKey, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(r io.Reader) ([]byte, error) {
+	reader, err := NewDecryptReader(r, streamTestKey)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	const chunkSize = 16
+	// 包含空数据和分段大小的整数倍
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3 * chunkSize, 100} {
+		plain := bytes.Repeat([]byte{'a'}, size)
+		cipherData := encryptStream(t, plain, chunkSize)
+		chunks := (size + chunkSize - 1) / chunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		if len(cipherData) != streamHeaderSize+size+chunks*16 {
+			t.Fatal(size, "密文长度不正确", len(cipherData))
+		}
+
+		decrypted, err := decryptStream(bytes.NewReader(cipherData))
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Fatal(size, "解密结果不正确")
+		}
+		// 每次只能读取1字节的底层数据流
+		if decrypted, err = decryptStream(iotest.OneByteReader(bytes.NewReader(cipherData))); err != nil || !bytes.Equal(decrypted, plain) {
+			t.Fatal(size, "逐字节读取密文时解密失败", err)
+		}
+		// 每次只读取1字节的明文
+		reader, err := NewDecryptReader(bytes.NewReader(cipherData), streamTestKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted, err = ioutil.ReadAll(iotest.OneByteReader(reader)); err != nil || !bytes.Equal(decrypted, plain) {
+			t.Fatal(size, "逐字节读取明文时解密失败", err)
+		}
+	}
+}
+
+func TestStreamWriteByByte(t *testing.T) {
+	plain := bytes.Repeat([]byte("0123456789"), 10)
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, streamTestKey, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range plain {
+		if _, err = w.Write(plain[k : k+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decryptStream(&buf)
+	if err != nil || !bytes.Equal(decrypted, plain) {
+		t.Fatal("解密失败", err)
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+	const chunkSize = 16
+	plain := bytes.Repeat([]byte{'a'}, 3*chunkSize)
+	cipherData := encryptStream(t, plain, chunkSize)
+	// 每段密文的长度
+	const sealed = chunkSize + 16
+	chunk := func(i int) []byte {
+		return cipherData[streamHeaderSize+i*sealed : streamHeaderSize+(i+1)*sealed]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	header := cipherData[:streamHeaderSize]
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "只有头部", data: header},
+		{name: "在第1段之后截断", data: cipherData[:streamHeaderSize+sealed]},
+		{name: "在第2段之后截断", data: cipherData[:streamHeaderSize+2*sealed]},
+		{name: "在分段中间截断", data: cipherData[:len(cipherData)-1]},
+		{name: "调换分段", data: join(header, chunk(1), chunk(0), chunk(2))},
+		{name: "删除分段", data: join(header, chunk(0), chunk(2))},
+		{name: "重复分段", data: join(header, chunk(0), chunk(0), chunk(1), chunk(2))},
+		{name: "末尾追加数据", data: join(cipherData, []byte{0})},
+		{name: "修改密文", data: join(header, chunk(0), chunk(1), []byte{chunk(2)[0] ^ 1}, chunk(2)[1:])},
+		{name: "修改salt", data: join(header[:5], []byte{header[5] ^ 1}, cipherData[6:])},
+		{name: "修改nonce前缀", data: join(header[:streamHeaderSize-1], []byte{header[streamHeaderSize-1] ^ 1}, cipherData[streamHeaderSize:])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decryptStream(bytes.NewReader(tt.data)); err != ErrAuthFailed {
+				t.Fatal("应返回ErrAuthFailed", err)
+			}
+		})
+	}
+
+	// 头部错误
+	if _, err := decryptStream(bytes.NewReader(header[:3])); err != ErrAuthFailed {
+		t.Fatal("头部不完整时应返回ErrAuthFailed", err)
+	}
+	if _, err := decryptStream(bytes.NewReader(join([]byte{StreamVersion + 1}, cipherData[1:]))); err != ErrUnsupportedVersion {
+		t.Fatal("版本号错误时应返回ErrUnsupportedVersion", err)
+	}
+	if _, err := decryptStream(bytes.NewReader(join(header[:1], []byte{0, 0, 0, 0}, cipherData[5:]))); err == nil {
+		t.Fatal("分段大小为0时应返回错误")
+	}
+	// 密钥错误
+	reader, err := NewDecryptReader(bytes.NewReader(cipherData), []byte("fedcba9876543210fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(reader); err != ErrAuthFailed {
+		t.Fatal("密钥错误时应返回ErrAuthFailed", err)
+	}
+}
+
+func TestStreamSubkey(t *testing.T) {
+	cipherData := encryptStream(t, []byte("hello world"), 16)
+	header := cipherData[:streamHeaderSize]
+	// 分段使用派生的子密钥加密，不能直接使用原密钥解密
+	aead, err := newGCM(streamTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = aead.Open(nil, streamNonce(header, 0, true), cipherData[streamHeaderSize:], header); err == nil {
+		t.Fatal("不应使用原密钥加密")
+	}
+	// 每个数据流的salt不同
+	other := encryptStream(t, []byte("hello world"), 16)
+	if bytes.Equal(header[5:5+streamSaltSize], other[5:5+streamSaltSize]) {
+		t.Fatal("salt没有随机生成")
+	}
+}
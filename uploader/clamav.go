@@ -0,0 +1,153 @@
+package uploader
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// 默认的INSTREAM分块大小
+const defaultClamAVChunkSize = 64 << 10
+
+// ClamAV clamd的客户端，使用INSTREAM命令扫描数据
+type ClamAV struct {
+	Network   string        // 网络类型，tcp或unix
+	Address   string        // clamd的地址，如127.0.0.1:3310或/var/run/clamav/clamd.ctl
+	Timeout   time.Duration // 单次扫描的超时时间，0表示不限制
+	ChunkSize int           // 每次发送的数据大小，不能超过clamd的StreamMaxLength，0则使用64KB
+}
+
+// Ping 检查clamd是否可用
+func (c *ClamAV) Ping() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if _, err = conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readClamAVReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return errors.New("clamd响应异常 " + reply)
+	}
+	return nil
+}
+
+// Scan 扫描数据
+func (c *ClamAV) Scan(r io.Reader) (result ScanResult, err error) {
+	conn, err := c.dial()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	readErr, writeErr := c.stream(conn, r)
+	if readErr != nil {
+		return result, readErr
+	}
+	reply, err := readClamAVReply(conn)
+	if err != nil {
+		// 数据超出clamd的限制时，clamd会先响应错误再断开连接，优先返回响应中的错误
+		if writeErr != nil {
+			err = writeErr
+		}
+		return
+	}
+	return parseClamAVReply(reply)
+}
+
+// dial 连接clamd并设置超时时间
+func (c *ClamAV) dial() (net.Conn, error) {
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+	dialer := net.Dialer{Timeout: c.Timeout}
+	conn, err := dialer.Dial(network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	if c.Timeout > 0 {
+		if err = conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// stream 发送INSTREAM命令和数据，每块数据前为4字节大端序的长度，以长度为0的块结束
+// readErr为读取数据时的错误，writeErr为发送到clamd时的错误
+func (c *ClamAV) stream(w io.Writer, r io.Reader) (readErr, writeErr error) {
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultClamAVChunkSize
+	}
+	bw := bufio.NewWriterSize(w, chunkSize+4)
+	if _, writeErr = bw.WriteString("zINSTREAM\x00"); writeErr != nil {
+		return
+	}
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, writeErr = bw.Write(size); writeErr != nil {
+				return
+			}
+			if _, writeErr = bw.Write(buf[:n]); writeErr != nil {
+				return
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err, nil
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, writeErr = bw.Write(size); writeErr != nil {
+		return
+	}
+	writeErr = bw.Flush()
+	return
+}
+
+// readClamAVReply 读取以\x00结尾的响应
+func readClamAVReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", err
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseClamAVReply 解析扫描结果，格式为"stream: OK"、"stream: 病毒名称 FOUND"或"错误信息 ERROR"
+func parseClamAVReply(reply string) (result ScanResult, err error) {
+	msg := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case msg == "OK":
+	case strings.HasSuffix(msg, " FOUND"):
+		result.Infected = true
+		result.Signature = strings.TrimSuffix(msg, " FOUND")
+	case strings.HasSuffix(msg, " ERROR"):
+		err = errors.New("clamd扫描失败 " + strings.TrimSuffix(msg, " ERROR"))
+	default:
+		err = errors.New("clamd响应异常 " + reply)
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package uploader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// clamdStub 模拟clamd的INSTREAM和PING命令，数据包含eicar时报告病毒，超过maxSize时报告错误
+func clamdStub(t *testing.T, maxSize int) (addr string, closeFunc func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleClamdConn(conn, maxSize)
+		}
+	}()
+	return listener.Addr().String(), func() {
+		_ = listener.Close()
+	}
+}
+
+func handleClamdConn(conn net.Conn, maxSize int) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case "zPING\x00":
+		_, _ = conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	var data bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(r, size); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if data.Len()+int(n) > maxSize {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			// 读取剩余数据，避免客户端写入时连接被重置
+			_, _ = io.Copy(ioutil.Discard, r)
+			return
+		}
+		if _, err = io.CopyN(&data, r, int64(n)); err != nil {
+			return
+		}
+	}
+	if strings.Contains(data.String(), eicar) {
+		_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAV(t *testing.T) {
+	addr, closeFunc := clamdStub(t, 1024)
+	defer closeFunc()
+	client := &ClamAV{Address: addr, ChunkSize: 16}
+
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Scan(strings.NewReader("hello world"))
+	if err != nil || result.Infected {
+		t.Fatalf("clean: %+v %v", result, err)
+	}
+
+	result, err = client.Scan(strings.NewReader("prefix " + eicar + " suffix"))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("infected: %+v %v", result, err)
+	}
+
+	if _, err = client.Scan(bytes.NewReader(make([]byte, 4096))); err == nil || !strings.Contains(err.Error(), "size limit") {
+		t.Fatalf("size limit: %v", err)
+	}
+}
+
+func TestUploaderScanner(t *testing.T) {
+	addr, closeFunc := clamdStub(t, 1<<20)
+	defer closeFunc()
+
+	upload := func(content string, quarantine Storage) (*MemoryStorage, Result, Error) {
+		req := uploadertest.NewRequest("/", uploadertest.Text("file", "test.txt", content))
+
+		storage := &MemoryStorage{}
+		obj := Uploader{
+			FieldName:  "file",
+			MaxSize:    1024,
+			AllowMIME:  []string{"text/plain"},
+			Storage:    storage,
+			Scanner:    &ClamAV{Address: addr},
+			Quarantine: quarantine,
+			Request:    req,
+		}
+		result, execErr := obj.Exec()
+		return storage, result, execErr
+	}
+
+	storage, result, execErr := upload("hello world", &MemoryStorage{})
+	if execErr.Status != 0 {
+		t.Fatal(execErr.OriginalError)
+	}
+	if data, ok := storage.Get(result.FileName); !ok || string(data) != "hello world" {
+		t.Fatalf("clean file not stored: %q", data)
+	}
+
+	quarantine := &MemoryStorage{}
+	storage, _, execErr = upload(eicar, quarantine)
+	var infectedErr *InfectedError
+	if execErr.Status != 422 || !errors.As(execErr.OriginalError, &infectedErr) {
+		t.Fatalf("unexpected error: %+v", execErr)
+	}
+	if ok, _ := storage.Exists("test.txt"); ok {
+		t.Fatal("infected file stored")
+	}
+	if data, ok := quarantine.Get(infectedErr.Quarantine); !ok || string(data) != eicar {
+		t.Fatalf("infected file not quarantined: %q", infectedErr.Quarantine)
+	}
+
+	// 写入隔离存储失败时记录错误
+	storage, _, execErr = upload(eicar, failingStorage{&MemoryStorage{}})
+	infectedErr = nil
+	if execErr.Status != 422 || !errors.As(execErr.OriginalError, &infectedErr) {
+		t.Fatalf("unexpected error: %+v", execErr)
+	}
+	if infectedErr.Quarantine != "" || !errors.Is(infectedErr.QuarantineErr, errPutFailed) {
+		t.Fatalf("quarantine error not recorded: %+v", infectedErr)
+	}
+	if ok, _ := storage.Exists("test.txt"); ok {
+		t.Fatal("infected file stored")
+	}
+}
+
+var errPutFailed = errors.New("put failed")
+
+// failingStorage 写入总是失败的存储后端
+type failingStorage struct {
+	*MemoryStorage
+}
+
+func (failingStorage) Put(string, io.Reader, PutOptions) error {
+	return errPutFailed
+}
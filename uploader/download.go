@@ -0,0 +1,254 @@
+package uploader
+
+import (
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dxvgef/gommon/encrypt"
+)
+
+// 签名下载地址的参数名
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+type (
+	// DownloadOptions 下载Handler的参数
+	DownloadOptions struct {
+		Storage      Storage                                  // 存储后端，必须实现Opener，留空则使用SaveRootPath的本地磁盘存储
+		SaveRootPath string                                   // 存储根路径（绝对路径），仅在Storage为nil时生效
+		Authorize    func(r *http.Request, name string) error // 权限检查，name为文件在存储中的路径，返回错误时响应403
+		URLSecret    []byte                                   // 下载地址的签名密钥，设置后每个请求都必须携带SignDownloadURL签发的有效签名
+		InlineMIME   []string                                 // 允许浏览器直接显示（inline）的MIME值，支持image/*形式的通配符，为空则全部作为附件下载
+		CacheControl string                                   // Cache-Control头信息，留空则不输出
+		Language     string                                   // 错误文本使用的语言，如LangZH、LangEN，留空则使用中文
+		OnError      func(r *http.Request, err Error)         // 出错时的回调，可用于记录OriginalError
+	}
+	downloadHandler struct {
+		opts   DownloadOptions
+		opener Opener
+	}
+)
+
+// NewDownloadHandler 创建下载文件的http.Handler，使用请求路径作为文件在存储中的路径，可配合http.StripPrefix使用
+// 支持Range请求，存在元数据文件时使用其中的MIME值、SHA-256值（ETag）和原始文件名，不允许下载元数据文件和以.开头的文件
+// 默认以附件的形式下载，只有InlineMIME中的类型才允许浏览器直接显示
+func NewDownloadHandler(opts DownloadOptions) (http.Handler, error) {
+	storage := opts.Storage
+	if storage == nil {
+		storage = &LocalStorage{RootPath: opts.SaveRootPath}
+	}
+	opener, ok := storage.(Opener)
+	if !ok {
+		return nil, errors.New("存储后端不支持读取文件")
+	}
+	opts.Storage = storage
+	return &downloadHandler{opts: opts, opener: opener}, nil
+}
+
+// SignDownloadURL 使用HMAC-SHA256签发下载地址，name为文件在存储中的路径，地址在ttl之后过期
+// downloadURL为下载Handler的地址前缀，签名只包含name和过期时间，与前缀无关
+func SignDownloadURL(downloadURL, name string, secret []byte, ttl time.Duration) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("secret不能为空")
+	}
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+	u, err := url.Parse(joinURL(downloadURL, name))
+	if err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	sign, err := encrypt.SHA256ByBytes([]byte(name+"\n"+expires), secret)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(ExpiresParam, expires)
+	query.Set(SignatureParam, sign)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// ServeHTTP 输出文件
+func (h *downloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if execErr := h.serve(w, r); execErr.Status != 0 {
+		if h.opts.OnError != nil {
+			h.opts.OnError(r, execErr)
+		}
+		if execErr.Status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", "GET, HEAD")
+		}
+		writeResponse(w, execErr.Status, &Response{Error: newResponseError(execErr)})
+	}
+}
+
+// serve 检查权限并输出文件，返回的错误尚未写入响应
+func (h *downloadHandler) serve(w http.ResponseWriter, r *http.Request) (execErr Error) {
+	lang := h.opts.Language
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return newError(lang, ErrMethodNotAllowed, http.StatusMethodNotAllowed, errors.New("不支持的请求方法 "+r.Method))
+	}
+	name := strings.TrimLeft(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || strings.HasSuffix(name, metadataSuffix) || strings.HasPrefix(name, ".") || strings.Contains(name, "/.") {
+		return newError(lang, ErrFileNotFound, http.StatusNotFound, errors.New("不允许下载的文件 "+name))
+	}
+	if len(h.opts.URLSecret) > 0 {
+		if execErr = h.verifyURL(r, name); execErr.Status != 0 {
+			return
+		}
+	}
+	if h.opts.Authorize != nil {
+		if err := h.opts.Authorize(r, name); err != nil {
+			return newError(lang, ErrDownloadForbidden, http.StatusForbidden, err)
+		}
+	}
+
+	file, err := h.opener.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return newError(lang, ErrFileNotFound, http.StatusNotFound, err)
+		}
+		return newError(lang, ErrDownloadFailed, http.StatusInternalServerError, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// 元数据文件是可选的
+	var modTime time.Time
+	header := w.Header()
+	metadata, err := ReadMetadata(h.opts.Storage, name)
+	if err == nil {
+		if metadata.FileMIME != "" {
+			header.Set("Content-Type", metadata.FileMIME)
+		}
+		if metadata.SHA256 != "" {
+			header.Set("ETag", `"`+metadata.SHA256+`"`)
+		}
+		if metadata.CreatedAt > 0 {
+			modTime = time.Unix(metadata.CreatedAt, 0)
+		}
+	}
+	if statInterface, ok := file.(_statInterface); ok {
+		info, err := statInterface.Stat()
+		if err != nil {
+			return newError(lang, ErrDownloadFailed, http.StatusInternalServerError, err)
+		}
+		if info.IsDir() {
+			return newError(lang, ErrFileNotFound, http.StatusNotFound, errors.New("不允许下载目录 "+name))
+		}
+		if modTime.IsZero() {
+			modTime = info.ModTime()
+		}
+	}
+	fileName := metadata.OriginalName
+	if fileName == "" {
+		fileName = path.Base(name)
+	}
+	header.Set("Content-Disposition", contentDisposition(h.inline(header.Get("Content-Type")), fileName))
+	header.Set("X-Content-Type-Options", "nosniff")
+	if h.opts.CacheControl != "" {
+		header.Set("Cache-Control", h.opts.CacheControl)
+	}
+
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, fileName, modTime, seeker)
+		return
+	}
+	// 无法Seek时不支持Range请求，只处理If-None-Match
+	etag := header.Get("ETag")
+	if etag != "" && matchETag(r.Header.Get("If-None-Match"), etag) {
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if metadata.FileSize > 0 {
+		header.Set("Content-Length", strconv.FormatInt(metadata.FileSize, 10))
+	}
+	header.Set("Accept-Ranges", "none")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, file)
+	}
+	return
+}
+
+// verifyURL 校验下载地址的签名和有效期
+func (h *downloadHandler) verifyURL(r *http.Request, name string) Error {
+	lang := h.opts.Language
+	query := r.URL.Query()
+	expires, sign := query.Get(ExpiresParam), query.Get(SignatureParam)
+	expected, err := encrypt.SHA256ByBytes([]byte(name+"\n"+expires), h.opts.URLSecret)
+	if err != nil {
+		return newError(lang, ErrInvalidURL, http.StatusForbidden, err)
+	}
+	if sign == "" || !hmac.Equal([]byte(sign), []byte(expected)) {
+		return newError(lang, ErrInvalidURL, http.StatusForbidden, errors.New("下载地址的签名无效"))
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return newError(lang, ErrInvalidURL, http.StatusForbidden, err)
+	}
+	if time.Now().Unix() > expiresAt {
+		return newError(lang, ErrURLExpired, http.StatusForbidden, errors.New("下载地址已过期"))
+	}
+	return Error{}
+}
+
+// inline 判断是否允许浏览器直接显示该MIME值的文件，可能执行脚本的类型始终作为附件下载
+func (h *downloadHandler) inline(mimeType string) bool {
+	if mimeType == "" || len(h.opts.InlineMIME) == 0 {
+		return false
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	if inStr(scriptableMIME, mimeType) || strings.HasSuffix(mimeType, "+xml") {
+		return false
+	}
+	return matchMIME(h.opts.InlineMIME, mimeType)
+}
+
+// 浏览器直接显示时可能执行脚本的MIME值
+var scriptableMIME = []string{"text/html", "text/xml", "application/xml", "application/xhtml+xml", "image/svg+xml", "text/javascript", "application/javascript"}
+
+// contentDisposition 生成Content-Disposition头信息，非ASCII文件名使用RFC 5987编码
+func contentDisposition(inline bool, fileName string) string {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	var fallback strings.Builder
+	for i := 0; i < len(fileName); i++ {
+		c := fileName[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			c = '_'
+		}
+		fallback.WriteByte(c)
+	}
+	if fallback.String() == fileName {
+		return disposition + `; filename="` + fileName + `"`
+	}
+	return disposition + `; filename="` + fallback.String() + `"; filename*=UTF-8''` + s3Escape(fileName)
+}
+
+// matchETag 判断If-None-Match是否匹配ETag，忽略弱校验前缀
+func matchETag(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package uploader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadHandler(t *testing.T) {
+	storage := &MemoryStorage{}
+	put := func(name, data string) {
+		if err := storage.Put(name, strings.NewReader(data), PutOptions{Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("a.txt", "0123456789")
+	put("a.txt"+metadataSuffix, `{"original_name":"原始.txt","file_mime":"text/plain","sha256":"abc","file_size":10}`)
+	put("b.html", "<script>alert(1)</script>")
+	put("b.html"+metadataSuffix, `{"file_mime":"text/html"}`)
+	put("c.png", "png")
+	put("c.png"+metadataSuffix, `{"file_mime":"image/png"}`)
+
+	handler, err := NewDownloadHandler(DownloadOptions{Storage: storage, InlineMIME: []string{"image/*", "text/html"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		path        string
+		header      map[string]string
+		status      int
+		body        string
+		disposition string
+	}{
+		{name: "下载", path: "/a.txt", status: 200, body: "0123456789", disposition: `attachment; filename="______.txt"; filename*=UTF-8''%E5%8E%9F%E5%A7%8B.txt`},
+		{name: "Range", path: "/a.txt", header: map[string]string{"Range": "bytes=2-4"}, status: 206, body: "234"},
+		{name: "ETag", path: "/a.txt", header: map[string]string{"If-None-Match": `"abc"`}, status: 304},
+		{name: "HTML不允许inline", path: "/b.html", status: 200, disposition: `attachment; filename="b.html"`},
+		{name: "图片inline", path: "/c.png", status: 200, disposition: `inline; filename="c.png"`},
+		{name: "元数据文件", path: "/a.txt" + metadataSuffix, status: 404},
+		{name: "不存在", path: "/d.txt", status: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatal("状态码", w.Code, "应为", tt.status, w.Body.String())
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Fatal("响应内容", w.Body.String(), "应为", tt.body)
+			}
+			if tt.disposition != "" && w.Header().Get("Content-Disposition") != tt.disposition {
+				t.Fatal("Content-Disposition", w.Header().Get("Content-Disposition"), "应为", tt.disposition)
+			}
+		})
+	}
+}
+
+func TestDownloadHandlerSignedURL(t *testing.T) {
+	storage := &MemoryStorage{}
+	if err := storage.Put("a.txt", strings.NewReader("a"), PutOptions{Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	handler, err := NewDownloadHandler(DownloadOptions{Storage: storage, URLSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := SignDownloadURL("/", "a.txt", secret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := SignDownloadURL("/", "a.txt", secret, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{name: "有效", url: valid, status: 200},
+		{name: "过期", url: expired, status: 403},
+		{name: "未签名", url: "/a.txt", status: 403},
+		{name: "篡改路径", url: strings.Replace(valid, "a.txt", "b.txt", 1), status: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if w.Code != tt.status {
+				t.Fatal("状态码", w.Code, "应为", tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package uploader
+
+import (
+	"strconv"
+	"sync"
+)
+
+// ErrorCode 错误代码，实现了error接口，可作为errors.Is的目标，例如errors.Is(execErr, ErrSizeExceeded)
+type ErrorCode uint16
+
+const (
+	ErrNoFile              ErrorCode = iota + 1 // 无法获得要上传的文件数据
+	ErrReadFailed                               // 无法读取要上传的文件数据
+	ErrEmptyFile                                // 文件大小为0
+	ErrSizeExceeded                             // 文件大小超出限制
+	ErrTotalSizeExceeded                        // 文件总大小超出限制
+	ErrMIMEMismatch                             // 文件内容与声明的类型或文件名不符
+	ErrMIMERejected                             // 不允许上传该类型的文件
+	ErrInvalidImage                             // 无法解析图片
+	ErrImageSize                                // 图片尺寸不符合要求
+	ErrInvalidPath                              // 文件路径不合法
+	ErrFileExists                               // 文件已存在
+	ErrStorageFailed                            // 写入存储后端失败
+	ErrScanFailed                               // 病毒扫描失败
+	ErrInfected                                 // 文件包含病毒
+	ErrCanceled                                 // 上传已取消
+	ErrTimeout                                  // 上传超时
+	ErrForbidden                                // 没有上传权限
+	ErrMethodNotAllowed                         // 不支持的请求方法
+	ErrBadRequest                               // 无法处理上传请求
+	ErrSessionFailed                            // 创建上传会话失败
+	ErrSessionNotFound                          // 上传会话不存在
+	ErrSessionExpired                           // 上传会话已过期
+	ErrChunkFailed                              // 写入分片数据失败
+	ErrChunkOffset                              // 分片的偏移量不正确
+	ErrChunkSizeExceeded                        // 分片数据超出文件大小
+	ErrIncomplete                               // 文件数据不完整
+	ErrChecksumMismatch                         // 文件校验失败
+	ErrExtRejected                              // 不允许上传该扩展名的文件
+	ErrFileTooSmall                             // 文件大小低于限制
+	ErrTooManyFiles                             // 文件数量超出限制
+	ErrRequestSizeExceeded                      // 请求大小超出限制
+	ErrInvalidToken                             // 上传令牌无效
+	ErrTokenExpired                             // 上传令牌已过期
+	ErrInvalidArchive                           // 无法解析压缩包
+	ErrArchiveLimit                             // 压缩包解压后超出限制
+	ErrArchivePath                              // 压缩包中的文件路径不合法
+	ErrFileNotFound                             // 文件不存在
+	ErrDownloadForbidden                        // 没有下载权限
+	ErrInvalidURL                               // 下载地址的签名无效
+	ErrURLExpired                               // 下载地址已过期
+	ErrDownloadFailed                           // 读取存储后端失败
+)
+
+// 内置的语言
+const (
+	LangZH = "zh"
+	LangEN = "en"
+)
+
+var (
+	messagesMutex sync.RWMutex
+	messages      = map[string]map[ErrorCode]string{
+		LangZH: {
+			ErrNoFile:              "无法获得要上传的文件数据",
+			ErrReadFailed:          "无法读取要上传的文件数据",
+			ErrEmptyFile:           "文件大小为0",
+			ErrSizeExceeded:        "文件大小超出限制",
+			ErrTotalSizeExceeded:   "文件总大小超出限制",
+			ErrMIMEMismatch:        "文件内容与文件类型不符",
+			ErrMIMERejected:        "不允许上传该类型的文件",
+			ErrInvalidImage:        "无法解析图片",
+			ErrImageSize:           "图片尺寸不符合要求",
+			ErrInvalidPath:         "文件路径不合法",
+			ErrFileExists:          "文件已存在",
+			ErrStorageFailed:       "上传文件失败",
+			ErrScanFailed:          "文件扫描失败",
+			ErrInfected:            "文件包含病毒",
+			ErrCanceled:            "上传已取消",
+			ErrTimeout:             "上传超时",
+			ErrForbidden:           "没有上传文件的权限",
+			ErrMethodNotAllowed:    "不支持的请求方法",
+			ErrBadRequest:          "无法处理上传请求",
+			ErrSessionFailed:       "创建上传会话失败",
+			ErrSessionNotFound:     "上传会话不存在",
+			ErrSessionExpired:      "上传会话已过期",
+			ErrChunkFailed:         "写入分片数据失败",
+			ErrChunkOffset:         "分片的偏移量不正确",
+			ErrChunkSizeExceeded:   "分片数据超出文件大小",
+			ErrIncomplete:          "文件数据不完整",
+			ErrChecksumMismatch:    "文件校验失败",
+			ErrExtRejected:         "不允许上传该扩展名的文件",
+			ErrFileTooSmall:        "文件大小低于限制",
+			ErrTooManyFiles:        "文件数量超出限制",
+			ErrRequestSizeExceeded: "请求大小超出限制",
+			ErrInvalidToken:        "上传令牌无效",
+			ErrTokenExpired:        "上传令牌已过期",
+			ErrInvalidArchive:      "无法解析压缩包",
+			ErrArchiveLimit:        "压缩包解压后超出限制",
+			ErrArchivePath:         "压缩包中的文件路径不合法",
+			ErrFileNotFound:        "文件不存在",
+			ErrDownloadForbidden:   "没有下载文件的权限",
+			ErrInvalidURL:          "下载地址无效",
+			ErrURLExpired:          "下载地址已过期",
+			ErrDownloadFailed:      "读取文件失败",
+		},
+		LangEN: {
+			ErrNoFile:              "No file was uploaded",
+			ErrReadFailed:          "Unable to read the uploaded file",
+			ErrEmptyFile:           "The file is empty",
+			ErrSizeExceeded:        "The file is too large",
+			ErrTotalSizeExceeded:   "The files are too large in total",
+			ErrMIMEMismatch:        "The file content does not match its type",
+			ErrMIMERejected:        "This file type is not allowed",
+			ErrInvalidImage:        "Unable to decode the image",
+			ErrImageSize:           "The image dimensions are not allowed",
+			ErrInvalidPath:         "Invalid file path",
+			ErrFileExists:          "The file already exists",
+			ErrStorageFailed:       "Failed to save the file",
+			ErrScanFailed:          "Failed to scan the file",
+			ErrInfected:            "The file contains a virus",
+			ErrCanceled:            "The upload was canceled",
+			ErrTimeout:             "The upload timed out",
+			ErrForbidden:           "You are not allowed to upload files",
+			ErrMethodNotAllowed:    "Method not allowed",
+			ErrBadRequest:          "Unable to process the upload request",
+			ErrSessionFailed:       "Failed to create the upload session",
+			ErrSessionNotFound:     "The upload session does not exist",
+			ErrSessionExpired:      "The upload session has expired",
+			ErrChunkFailed:         "Failed to write the chunk",
+			ErrChunkOffset:         "Invalid chunk offset",
+			ErrChunkSizeExceeded:   "The chunk exceeds the file size",
+			ErrIncomplete:          "The file data is incomplete",
+			ErrChecksumMismatch:    "The file checksum does not match",
+			ErrExtRejected:         "This file extension is not allowed",
+			ErrFileTooSmall:        "The file is too small",
+			ErrTooManyFiles:        "Too many files",
+			ErrRequestSizeExceeded: "The request is too large",
+			ErrInvalidToken:        "Invalid upload token",
+			ErrTokenExpired:        "The upload token has expired",
+			ErrInvalidArchive:      "Unable to read the archive",
+			ErrArchiveLimit:        "The archive is too large when extracted",
+			ErrArchivePath:         "The archive contains an invalid file path",
+			ErrFileNotFound:        "The file does not exist",
+			ErrDownloadForbidden:   "You are not allowed to download this file",
+			ErrInvalidURL:          "Invalid download URL",
+			ErrURLExpired:          "The download URL has expired",
+			ErrDownloadFailed:      "Failed to read the file",
+		},
+	}
+)
+
+// RegisterMessages 注册或覆盖某个语言的错误文本，未注册的错误代码使用中文文本
+func RegisterMessages(lang string, msgs map[ErrorCode]string) {
+	messagesMutex.Lock()
+	defer messagesMutex.Unlock()
+	if messages[lang] == nil {
+		messages[lang] = make(map[ErrorCode]string, len(msgs))
+	}
+	for code, msg := range msgs {
+		messages[lang][code] = msg
+	}
+}
+
+// Message 获得错误代码在指定语言下的文本，lang为空或没有对应的文本时使用中文
+func (c ErrorCode) Message(lang string) string {
+	messagesMutex.RLock()
+	defer messagesMutex.RUnlock()
+	if msg, ok := messages[lang][c]; ok {
+		return msg
+	}
+	if msg, ok := messages[LangZH][c]; ok {
+		return msg
+	}
+	return "未知错误(" + strconv.Itoa(int(c)) + ")"
+}
+
+func (c ErrorCode) Error() string {
+	return c.Message(LangZH)
+}
+
+// Error 实现error接口，包含FriendlyText和OriginalError
+func (e Error) Error() string {
+	if e.OriginalError == nil {
+		return e.FriendlyText
+	}
+	return e.FriendlyText + ": " + e.OriginalError.Error()
+}
+
+// Unwrap 返回原始的错误，可使用errors.Is/As判断底层的系统错误
+func (e Error) Unwrap() error {
+	return e.OriginalError
+}
+
+// Is 判断错误代码，使errors.Is(execErr, ErrSizeExceeded)成立
+func (e Error) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && e.Code != 0 && code == e.Code
+}
+
+// Text 获得错误在指定语言下的文本
+func (e Error) Text(lang string) string {
+	if e.Code == 0 {
+		return e.FriendlyText
+	}
+	return e.Code.Message(lang)
+}
+
+// newError 创建Error，FriendlyText使用Language对应的文本
+func (obj *Uploader) newError(code ErrorCode, status int, err error) Error {
+	return newError(obj.Language, code, status, err)
+}
+
+// newError 创建Error，FriendlyText使用lang对应的文本
+func newError(lang string, code ErrorCode, status int, err error) Error {
+	return Error{
+		Code:          code,
+		Status:        status,
+		OriginalError: err,
+		FriendlyText:  code.Message(lang),
+	}
+}
@@ -0,0 +1,360 @@
+package uploader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 解压参数的默认值
+const (
+	defaultExtractMaxSize    = 1 << 30
+	defaultExtractMaxEntries = 10000
+	defaultExtractMaxRatio   = 100
+)
+
+var (
+	errArchiveLimit = errors.New("压缩包解压后超出限制")
+	errArchivePath  = errors.New("压缩包中的文件路径不合法")
+)
+
+type (
+	// ExtractOptions 压缩包解压参数，仅对zip、tar和tar.gz文件生效，解压后的文件存放在SaveSubPath中
+	// 解压出的每个文件都按上传控件的规则校验扩展名和文件大小上限
+	ExtractOptions struct {
+		MaxSize    int64    // 解压后的总大小上限（字节），0则为1GB
+		MaxEntries int      // 压缩包中的条目数量上限（包括目录和嵌套压缩包中的条目），0则为10000
+		MaxRatio   int64    // 解压后的总大小与压缩包大小的比例上限，0则为100
+		MaxDepth   int      // 嵌套压缩包的解压层数，超出层数的压缩包作为普通文件保存，0表示不解压嵌套的压缩包
+		AllowMIME  []string // 允许解压的文件MIME值，支持image/*形式的通配符，为空则使用上传控件的规则（Rule.AllowMIME或Uploader.AllowMIME）
+	}
+	// ExtractedFile 从压缩包中解压出的文件
+	ExtractedFile struct {
+		FileName string `json:"file_name"`     // 文件名（相对SaveSubPath，包含压缩包中的目录）
+		FileSize int64  `json:"file_size"`     // 文件大小
+		FileMIME string `json:"file_mime"`     // 文件的MIME值（按文件内容识别）
+		URL      string `json:"url,omitempty"` // 文件的访问地址，由存储后端生成
+	}
+	// extractor 解压过程中的状态
+	extractor struct {
+		ctx     context.Context
+		obj     *Uploader
+		storage Storage
+		opts    ExtractOptions
+		rule    Rule  // 上传控件的校验规则
+		budget  int64 // 剩余可解压的字节数
+		entries int
+		files   []ExtractedFile
+		names   []string // 已写入的完整路径，用于出错时删除
+	}
+)
+
+// isArchiveMIME 判断是否为可解压的压缩包格式
+func isArchiveMIME(mimeType string) bool {
+	return mimeType == "application/zip" || mimeType == "application/x-tar" || mimeType == "application/gzip"
+}
+
+// extract 将压缩包解压到SaveSubPath，file必须位于文件开头，出错时删除已解压的文件
+// 不包含tar数据的gzip文件不解压，此时返回的files为nil
+func (obj *Uploader) extract(ctx context.Context, storage Storage, rule Rule, file *os.File, fileName, mimeType string, size int64) (files []ExtractedFile, names []string, execErr Error) {
+	if mimeType == "application/gzip" {
+		tarGzip, err := isTarGzip(file, fileName)
+		if err != nil {
+			execErr = obj.newError(ErrReadFailed, 500, err)
+			return
+		}
+		if !tarGzip {
+			return
+		}
+	}
+
+	e := &extractor{
+		ctx:     ctx,
+		obj:     obj,
+		storage: storage,
+		opts:    *obj.Extract,
+		rule:    rule,
+	}
+	if e.opts.MaxSize <= 0 {
+		e.opts.MaxSize = defaultExtractMaxSize
+	}
+	if e.opts.MaxEntries <= 0 {
+		e.opts.MaxEntries = defaultExtractMaxEntries
+	}
+	if e.opts.MaxRatio <= 0 {
+		e.opts.MaxRatio = defaultExtractMaxRatio
+	}
+	e.budget = e.opts.MaxSize
+	if size > 0 && size <= e.budget/e.opts.MaxRatio {
+		e.budget = size * e.opts.MaxRatio
+	}
+
+	err := e.archive(file, size, mimeType, "", 0)
+	if err == nil {
+		return e.files, e.names, execErr
+	}
+	for k := range e.names {
+		_ = storage.Delete(e.names[k])
+	}
+	switch {
+	case errors.Is(err, errArchiveLimit):
+		execErr = obj.newError(ErrArchiveLimit, 400, fmt.Errorf("%w(大小%d、条目%d、比例%d)", err, e.opts.MaxSize, e.opts.MaxEntries, e.opts.MaxRatio))
+	case errors.Is(err, errArchivePath):
+		execErr = obj.newError(ErrArchivePath, 400, err)
+	case errors.Is(err, errSizeExceeded), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		execErr = obj.copyError(err, obj.maxBytes(rule))
+	default:
+		var entryErr Error
+		if errors.As(err, &entryErr) {
+			execErr = entryErr
+			return
+		}
+		execErr = obj.newError(ErrInvalidArchive, 400, err)
+	}
+	return
+}
+
+// archive 解压压缩包，dir为解压到的目录（相对SaveSubPath）
+func (e *extractor) archive(file *os.File, size int64, mimeType, dir string, depth int) error {
+	switch mimeType {
+	case "application/zip":
+		zipReader, err := zip.NewReader(file, size)
+		if err != nil {
+			return err
+		}
+		for _, f := range zipReader.File {
+			if err = e.count(); err != nil {
+				return err
+			}
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = e.entry(dir, f.Name, rc, depth)
+			_ = rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "application/x-tar":
+		return e.tar(tar.NewReader(file), dir, depth)
+	case "application/gzip":
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = gzipReader.Close()
+		}()
+		return e.tar(tar.NewReader(gzipReader), dir, depth)
+	}
+	return errors.New("不支持解压" + mimeType + "类型的文件")
+}
+
+// tar 解压tar数据流，只解压普通文件，忽略目录、链接等其它类型的条目
+func (e *extractor) tar(tarReader *tar.Reader, dir string, depth int) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = e.count(); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err = e.entry(dir, header.Name, tarReader, depth); err != nil {
+			return err
+		}
+	}
+}
+
+// count 计算条目数量
+func (e *extractor) count() error {
+	e.entries++
+	if e.entries > e.opts.MaxEntries {
+		return errArchiveLimit
+	}
+	return nil
+}
+
+// entry 解压单个文件，可解压的嵌套压缩包会继续解压到同名目录中
+func (e *extractor) entry(dir, entryName string, r io.Reader, depth int) error {
+	name, err := archivePath(entryName)
+	if err != nil {
+		return err
+	}
+	name = path.Join(dir, name)
+	if execErr := e.obj.checkFile(e.rule, name, -1); execErr.Status != 0 {
+		return execErr
+	}
+	reader := &sizeLimitReader{reader: &contextReader{ctx: e.ctx, reader: r}, limit: e.budget, err: errArchiveLimit}
+	defer func() {
+		e.budget -= reader.n
+	}()
+	// 每个文件的大小不能超出上传控件的限制
+	fileReader := &sizeLimitReader{reader: reader, limit: e.obj.maxBytes(e.rule), err: errSizeExceeded}
+
+	// 识别文件类型
+	sniffData := make([]byte, sniffLen)
+	n, err := io.ReadFull(fileReader, sniffData)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	sniffData = sniffData[:n]
+	sniffed := DetectMIME(sniffData)
+	mimeType, ok := verifyMIME(sniffed, "", path.Ext(name))
+	if !ok {
+		return e.obj.newError(ErrMIMEMismatch, 415, errors.New("压缩包中的文件内容("+sniffed+")与文件名("+name+")不符"))
+	}
+	body := io.MultiReader(bytes.NewReader(sniffData), fileReader)
+
+	// 解压嵌套的压缩包
+	if isArchiveMIME(mimeType) && depth < e.opts.MaxDepth {
+		tempFile, err := e.obj.tempFile()
+		if err != nil {
+			return err
+		}
+		defer closeSpool(tempFile)
+		size, err := io.Copy(tempFile, body)
+		if err != nil {
+			return err
+		}
+		if _, err = tempFile.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		tarGzip := true
+		if mimeType == "application/gzip" {
+			if tarGzip, err = isTarGzip(tempFile, name); err != nil {
+				return err
+			}
+		}
+		if tarGzip {
+			// 嵌套的压缩包本身也计入解压后的大小
+			e.budget -= reader.n
+			reader.n = 0
+			return e.archive(tempFile, size, mimeType, strings.TrimSuffix(strings.TrimSuffix(name, path.Ext(name)), ".tar"), depth+1)
+		}
+		// 不包含tar数据的gzip文件作为普通文件保存
+		body = tempFile
+	}
+
+	allowed := e.obj.allowMIME(e.rule, mimeType)
+	if len(e.opts.AllowMIME) > 0 {
+		allowed = matchMIME(e.opts.AllowMIME, mimeType)
+	}
+	if !allowed {
+		return e.obj.newError(ErrMIMERejected, 400, errors.New("压缩包中不允许包含"+mimeType+"类型的文件("+name+")"))
+	}
+	fullName, err := safeName(e.obj.SaveSubPath, name, "")
+	if err != nil {
+		return fmt.Errorf("%w: %s", errArchivePath, err.Error())
+	}
+	err = e.storage.Put(fullName, body, PutOptions{
+		Size:        -1,
+		MIME:        mimeType,
+		NoOverwrite: e.obj.Overwrite != OverwriteReplace,
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errArchiveLimit), errors.Is(err, errSizeExceeded), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case errors.Is(err, os.ErrExist):
+		return e.obj.newError(ErrFileExists, 409, fmt.Errorf("文件已存在 %s: %w", fullName, err))
+	default:
+		return e.obj.newError(ErrStorageFailed, 500, fmt.Errorf("写入文件失败 %s: %w", fullName, err))
+	}
+	e.names = append(e.names, fullName)
+	e.files = append(e.files, ExtractedFile{
+		FileName: name,
+		FileSize: reader.n,
+		FileMIME: mimeType,
+		URL:      e.storage.URL(fullName),
+	})
+	return nil
+}
+
+// isTarGzip 判断gzip文件是否为tar.gz，文件名以.tar.gz或.tgz结尾，或者解压后的数据以有效的tar头部开始
+// 判断后file重新定位到文件开头
+func isTarGzip(file io.ReadSeeker, fileName string) (bool, error) {
+	lower := strings.ToLower(fileName)
+	if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+		return true, nil
+	}
+	block := make([]byte, 512)
+	n := 0
+	if gzipReader, err := gzip.NewReader(file); err == nil {
+		n, _ = io.ReadFull(gzipReader, block)
+		_ = gzipReader.Close()
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return n == len(block) && isTarHeader(block), nil
+}
+
+// isTarHeader 按校验和判断是否为有效的tar头部
+func isTarHeader(block []byte) bool {
+	field := strings.Trim(string(block[148:156]), " \x00")
+	if field == "" {
+		return false
+	}
+	expected, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+	// 计算校验和时校验和字段按空格计算
+	var sum int64
+	for i := range block {
+		if i >= 148 && i < 156 {
+			sum += ' '
+			continue
+		}
+		sum += int64(block[i])
+	}
+	return sum == expected
+}
+
+// archivePath 校验并清理压缩包中的文件路径，拒绝绝对路径和包含..的路径
+func archivePath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || strings.HasPrefix(name, "/") ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: %s", errArchivePath, strconv.Quote(name))
+	}
+	elems := strings.Split(name, "/")
+	cleaned := elems[:0]
+	for k := range elems {
+		switch elems[k] {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("%w: %s", errArchivePath, strconv.Quote(name))
+		}
+		elem := SanitizeFileName(elems[k])
+		if elem == "" {
+			return "", fmt.Errorf("%w: %s", errArchivePath, strconv.Quote(name))
+		}
+		cleaned = append(cleaned, elem)
+	}
+	if len(cleaned) == 0 {
+		return "", fmt.Errorf("%w: %s", errArchivePath, strconv.Quote(name))
+	}
+	return strings.Join(cleaned, "/"), nil
+}
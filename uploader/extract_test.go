@@ -0,0 +1,194 @@
+package uploader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractGzip(t *testing.T) {
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	content := []byte("hello world")
+	if err := tw.WriteHeader(&tar.Header{Name: "dir/a.txt", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = tw.Write(content)
+	_ = tw.Close()
+
+	// zip中嵌套普通的gzip文件
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	fw, err := zw.Create("logs/log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(gzipData(t, []byte("line 1\n")))
+	_ = zw.Close()
+
+	tests := []struct {
+		name      string
+		fileName  string
+		data      []byte
+		extracted string // 解压出的文件，为空表示不解压
+	}{
+		{name: "普通gzip文件", fileName: "log.gz", data: gzipData(t, []byte("line 1\nline 2\n")), extracted: ""},
+		{name: "tar.gz", fileName: "a.tar.gz", data: gzipData(t, tarData.Bytes()), extracted: "dir/a.txt"},
+		{name: "扩展名为gz的tar.gz", fileName: "b.gz", data: gzipData(t, tarData.Bytes()), extracted: "dir/a.txt"},
+		{name: "嵌套的普通gzip文件", fileName: "c.zip", data: zipData.Bytes(), extracted: "logs/log.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &MemoryStorage{}
+			obj := Uploader{
+				FieldName: "file",
+				MaxSize:   1024,
+				AllowMIME: []string{"application/gzip", "application/zip", "text/plain"},
+				Extract:   &ExtractOptions{MaxDepth: 1},
+				Storage:   storage,
+				Request:   uploadertest.NewRequest("/", uploadertest.Bytes("file", tt.fileName, tt.data)),
+			}
+			result, execErr := obj.Exec()
+			if execErr.Status != 0 {
+				t.Fatal(execErr)
+			}
+			if tt.extracted == "" {
+				if len(result.Extracted) != 0 {
+					t.Fatalf("不应解压: %+v", result.Extracted)
+				}
+			} else if len(result.Extracted) != 1 || result.Extracted[0].FileName != tt.extracted {
+				t.Fatalf("解压的文件不正确: %+v", result.Extracted)
+			} else if ok, _ := storage.Exists(tt.extracted); !ok {
+				t.Fatal("解压的文件未保存", tt.extracted)
+			}
+			if data, ok := storage.Get(result.FileName); !ok || !bytes.Equal(data, tt.data) {
+				t.Fatal("压缩包本身未保存")
+			}
+		})
+	}
+}
+
+func zipData(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// files依次为文件名和文件内容
+	for i := 0; i+1 < len(files); i += 2 {
+		fw, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractRules(t *testing.T) {
+	png, err := ioutil.ReadAll(uploadertest.PNG("file", "a.png", 2, 2).Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		prepare func(obj *Uploader)
+		code    ErrorCode // 0表示应解压成功
+		status  int
+	}{
+		{
+			name: "禁止的扩展名",
+			data: zipData(t, "a.txt", "hello", "shell.php", "<?php echo 1;"),
+			prepare: func(obj *Uploader) {
+				obj.Rules = map[string]Rule{"file": {DenyExt: []string{"php", "html"}}}
+			},
+			code:   ErrExtRejected,
+			status: 400,
+		},
+		{
+			name:   "不允许的类型",
+			data:   zipData(t, "a.txt", "hello", "x.html", "<html><script>alert(1)</script></html>"),
+			code:   ErrMIMERejected,
+			status: 400,
+		},
+		{
+			name: "控件规则中的MIME值",
+			data: zipData(t, "a.txt", "hello"),
+			prepare: func(obj *Uploader) {
+				obj.Rules = map[string]Rule{"file": {AllowMIME: []string{"application/zip"}}}
+			},
+			code:   ErrMIMERejected,
+			status: 400,
+		},
+		{
+			name: "解压参数中的MIME值",
+			data: zipData(t, "a.png", string(png)),
+			prepare: func(obj *Uploader) {
+				obj.Extract.AllowMIME = []string{"image/*"}
+			},
+		},
+		{
+			name:   "文件过大",
+			data:   zipData(t, "a.txt", strings.Repeat("a", 2048)),
+			code:   ErrSizeExceeded,
+			status: 413,
+		},
+		{
+			name: "允许的文件",
+			data: zipData(t, "dir/a.txt", "hello"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &MemoryStorage{}
+			obj := Uploader{
+				FieldName:   "file",
+				MaxSize:     1,
+				AllowMIME:   []string{"application/zip", "text/plain"},
+				SaveSubPath: "s",
+				Extract:     &ExtractOptions{},
+				Storage:     storage,
+				Request:     uploadertest.NewRequest("/", uploadertest.Bytes("file", "a.zip", tt.data)),
+			}
+			if tt.prepare != nil {
+				tt.prepare(&obj)
+			}
+			result, execErr := obj.Exec()
+			if tt.code == 0 {
+				if execErr.Status != 0 {
+					t.Fatal(execErr)
+				}
+				if len(result.Extracted) != 1 {
+					t.Fatalf("解压的文件不正确: %+v", result.Extracted)
+				}
+				return
+			}
+			if !errors.Is(execErr, tt.code) || execErr.Status != tt.status {
+				t.Fatalf("应返回%d(%d)，实际为%d(%d): %v", tt.code, tt.status, execErr.Code, execErr.Status, execErr)
+			}
+			if names, _ := storage.List(""); len(names) > 0 {
+				t.Fatal("不应保留任何文件", names)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package uploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HandlerMode Handler处理上传的方式
+type HandlerMode uint8
+
+const (
+	HandleSingle   HandlerMode = iota // 使用Exec处理单个文件（默认）
+	HandleMultiple                    // 使用ExecAll处理多个文件
+	HandleStream                      // 使用ExecStream以流的方式处理多个文件
+)
+
+type (
+	// HandlerOptions Handler的参数
+	HandlerOptions struct {
+		Mode       HandlerMode                                // 处理上传的方式
+		FieldNames []string                                   // 多文件上传时的上传控件name值，留空则使用FieldName
+		Authorize  func(r *http.Request) error                // 权限检查，返回错误时响应403且不会读取文件数据
+		SubPath    func(r *http.Request) (string, error)      // 按请求生成SaveSubPath，返回错误时响应400
+		OnError    func(r *http.Request, err Error)           // 出错时的回调，可用于记录OriginalError
+		OnSuccess  func(r *http.Request, results []Result)    // 至少有一个文件保存成功时的回调
+		Prepare    func(r *http.Request, obj *Uploader) error // 执行上传前修改本次请求使用的上传参数，返回错误时响应400
+		// 上传令牌的密钥，设置后每个请求都必须携带SignUploadToken签发的有效令牌（URL参数token或X-Upload-Token头信息），
+		// 并使用令牌中的上传参数代替模板和SubPath生成的对应参数，令牌无效或已过期时响应403
+		TokenSecret []byte
+	}
+	// Response Handler响应的JSON数据
+	Response struct {
+		Results []Result         `json:"results,omitempty"` // 上传结果
+		Errors  []*ResponseError `json:"errors,omitempty"`  // 多文件上传时与Results一一对应的错误，null表示该文件上传成功
+		Error   *ResponseError   `json:"error,omitempty"`   // 整体性的错误
+	}
+	// ResponseError 响应中的错误信息，不包含OriginalError
+	ResponseError struct {
+		Code    ErrorCode `json:"code"`
+		Status  int       `json:"status"`
+		Message string    `json:"message"`
+	}
+	handler struct {
+		template Uploader
+		opts     HandlerOptions
+	}
+	contextKey struct{}
+	// contextValue Middleware保存到请求上下文中的上传结果
+	contextValue struct {
+		results  []Result
+		fileErrs []Error
+	}
+)
+
+// NewHandler 使用上传参数模板创建http.Handler，每个请求复制一份模板执行上传，并将结果或错误以JSON格式响应
+// 整体性的错误使用Error.Status作为HTTP状态码，多文件上传时只要有一个文件保存成功即响应200
+func NewHandler(template Uploader, opts HandlerOptions) http.Handler {
+	return &handler{template: template, opts: opts}
+}
+
+// Middleware 使用上传参数模板创建中间件，上传成功后将结果保存到请求上下文中再调用next，
+// 可在next中使用ResultsFromContext获得上传结果，整体性的错误直接以JSON格式响应且不会调用next
+func Middleware(template Uploader, opts HandlerOptions) func(next http.Handler) http.Handler {
+	h := &handler{template: template, opts: opts}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			results, fileErrs, execErr := h.exec(r)
+			if execErr.Status != 0 {
+				writeResponse(w, execErr.Status, &Response{
+					Results: results,
+					Error:   newResponseError(execErr),
+				})
+				return
+			}
+			ctx := context.WithValue(r.Context(), contextKey{}, &contextValue{results: results, fileErrs: fileErrs})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ResultsFromContext 获得Middleware保存到请求上下文中的上传结果，results和fileErrs一一对应
+func ResultsFromContext(ctx context.Context) (results []Result, fileErrs []Error, ok bool) {
+	value, ok := ctx.Value(contextKey{}).(*contextValue)
+	if !ok {
+		return nil, nil, false
+	}
+	return value.results, value.fileErrs, true
+}
+
+// ServeHTTP 执行上传并响应JSON
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results, fileErrs, execErr := h.exec(r)
+	if execErr.Status != 0 {
+		writeResponse(w, execErr.Status, &Response{
+			Results: results,
+			Error:   newResponseError(execErr),
+		})
+		return
+	}
+
+	resp := Response{Results: results}
+	status := http.StatusOK
+	failed := 0
+	for k := range fileErrs {
+		if fileErrs[k].Status != 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		resp.Errors = make([]*ResponseError, len(fileErrs))
+		for k := range fileErrs {
+			if fileErrs[k].Status != 0 {
+				resp.Errors[k] = newResponseError(fileErrs[k])
+			}
+		}
+		// 所有文件都保存失败时，使用第一个错误的状态码
+		if failed == len(fileErrs) {
+			status = fileErrs[0].Status
+		}
+	}
+	writeResponse(w, status, &resp)
+}
+
+// exec 检查权限并使用模板的副本执行上传
+func (h *handler) exec(r *http.Request) (results []Result, fileErrs []Error, execErr Error) {
+	defer func() {
+		if h.opts.OnError != nil {
+			if execErr.Status != 0 {
+				h.opts.OnError(r, execErr)
+			}
+			for k := range fileErrs {
+				if fileErrs[k].Status != 0 {
+					h.opts.OnError(r, fileErrs[k])
+				}
+			}
+		}
+		if h.opts.OnSuccess != nil && execErr.Status == 0 {
+			if success := successResults(results, fileErrs); len(success) > 0 {
+				h.opts.OnSuccess(r, success)
+			}
+		}
+	}()
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		execErr = h.template.newError(ErrMethodNotAllowed, http.StatusMethodNotAllowed, errors.New("不支持的请求方法 "+r.Method))
+		return
+	}
+	if h.opts.Authorize != nil {
+		if err := h.opts.Authorize(r); err != nil {
+			execErr = h.template.newError(ErrForbidden, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	var token UploadToken
+	if len(h.opts.TokenSecret) > 0 {
+		if token, execErr = h.template.verifyToken(r, h.opts.TokenSecret); execErr.Status != 0 {
+			return
+		}
+	}
+
+	obj := h.template
+	obj.Request = r
+	if h.opts.SubPath != nil {
+		subPath, err := h.opts.SubPath(r)
+		if err != nil {
+			execErr = h.template.newError(ErrInvalidPath, http.StatusBadRequest, err)
+			return
+		}
+		obj.SaveSubPath = subPath
+	}
+	fieldNames := h.opts.FieldNames
+	if len(h.opts.TokenSecret) > 0 {
+		if token.FieldName != "" {
+			fieldNames = []string{token.FieldName}
+		}
+		obj.applyToken(token, fieldNames)
+	}
+	if h.opts.Prepare != nil {
+		if err := h.opts.Prepare(r, &obj); err != nil {
+			execErr = h.template.newError(ErrBadRequest, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	switch h.opts.Mode {
+	case HandleMultiple:
+		return obj.ExecAll(fieldNames...)
+	case HandleStream:
+		return obj.ExecStream(fieldNames...)
+	}
+	result, fileErr := obj.Exec()
+	if fileErr.Status != 0 {
+		execErr = fileErr
+		return
+	}
+	return []Result{result}, []Error{{}}, Error{}
+}
+
+// successResults 获得保存成功的文件的上传结果
+func successResults(results []Result, fileErrs []Error) (success []Result) {
+	for k := range results {
+		if k >= len(fileErrs) || fileErrs[k].Status == 0 {
+			success = append(success, results[k])
+		}
+	}
+	return
+}
+
+func newResponseError(execErr Error) *ResponseError {
+	return &ResponseError{Code: execErr.Code, Status: execErr.Status, Message: execErr.FriendlyText}
+}
+
+// writeResponse 以JSON格式输出响应
+func writeResponse(w http.ResponseWriter, status int, resp *Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if status == http.StatusMethodNotAllowed && w.Header().Get("Allow") == "" {
+		w.Header().Set("Allow", "POST, PUT")
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
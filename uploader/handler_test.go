@@ -0,0 +1,270 @@
+package uploader
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+func TestHandlerTokenFieldNames(t *testing.T) {
+	secret := []byte("secret")
+	token, err := SignUploadToken(UploadToken{MaxSize: 3, AllowMIME: []string{"image/png"}}, secret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []HandlerMode{HandleMultiple, HandleStream} {
+		storage := &MemoryStorage{}
+		h := NewHandler(Uploader{
+			MaxSize:   1024,
+			AllowMIME: []string{"text/plain", "image/png"},
+			Storage:   storage,
+		}, HandlerOptions{Mode: mode, FieldNames: []string{"a", "b"}, TokenSecret: secret})
+
+		// 令牌没有指定上传控件时，令牌中的限制应用到所有上传控件
+		req := uploadertest.NewRequest("/?"+TokenParam+"="+token, uploadertest.Text("a", "a.txt", "this file is larger than 3 B"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code == http.StatusOK {
+			t.Fatal(mode, "应拒绝超出令牌限制的文件", w.Body.String())
+		}
+		if names, _ := storage.List(""); len(names) > 0 {
+			t.Fatal(mode, "不应写入文件", names)
+		}
+	}
+}
+
+// serve 使用handler处理请求并解析响应的JSON数据
+func serve(t *testing.T, h http.Handler, req *http.Request) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var resp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal("响应的JSON数据无效", w.Body.String(), err)
+	}
+	if w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatal("Content-Type不正确", w.Header().Get("Content-Type"))
+	}
+	return w, resp
+}
+
+func TestHandlerResponse(t *testing.T) {
+	// 每个请求都需要新的文件数据
+	html := func() uploadertest.File {
+		return uploadertest.Bytes("file", "b.html", []byte("<html><body>hello</body></html>"))
+	}
+	tests := []struct {
+		name    string
+		mode    HandlerMode
+		request *http.Request
+		status  int
+		results int         // 上传结果的数量
+		errors  []ErrorCode // 与上传结果一一对应的错误，0表示该文件上传成功，为nil表示响应中没有errors
+		err     ErrorCode   // 整体性的错误
+	}{
+		{name: "单个文件", request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello")), status: 200, results: 1},
+		{name: "单个文件上传失败", request: uploadertest.NewRequest("/", html()), status: 400, err: ErrMIMERejected},
+		{
+			name:    "多个文件",
+			mode:    HandleMultiple,
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello"), uploadertest.Text("file", "b.txt", "world")),
+			status:  200,
+			results: 2,
+		},
+		{
+			name:    "部分文件上传失败",
+			mode:    HandleMultiple,
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello"), html()),
+			status:  200,
+			results: 2,
+			errors:  []ErrorCode{0, ErrMIMERejected},
+		},
+		{
+			name:    "所有文件上传失败",
+			mode:    HandleStream,
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.php", "<?php"), html()),
+			status:  400,
+			results: 2,
+			errors:  []ErrorCode{ErrExtRejected, ErrMIMERejected},
+		},
+		{name: "不支持的请求方法", request: httptest.NewRequest(http.MethodGet, "/", nil), status: 405, err: ErrMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(Uploader{
+				FieldName: "file",
+				MaxSize:   1,
+				AllowMIME: []string{"text/plain"},
+				Rules:     map[string]Rule{"file": {DenyExt: []string{"php"}}},
+				Storage:   &MemoryStorage{},
+			}, HandlerOptions{Mode: tt.mode})
+			w, resp := serve(t, h, tt.request)
+			if w.Code != tt.status {
+				t.Fatal("状态码应为", tt.status, "实际为", w.Code, w.Body.String())
+			}
+			if len(resp.Results) != tt.results {
+				t.Fatal("上传结果的数量应为", tt.results, "实际为", w.Body.String())
+			}
+			if tt.err != 0 {
+				if resp.Error == nil || resp.Error.Code != tt.err || resp.Error.Status != tt.status || resp.Error.Message == "" {
+					t.Fatal("错误信息不正确", w.Body.String())
+				}
+			} else if resp.Error != nil {
+				t.Fatal("不应返回整体性的错误", w.Body.String())
+			}
+			if len(resp.Errors) != len(tt.errors) {
+				t.Fatal("errors不正确", w.Body.String())
+			}
+			for k, code := range tt.errors {
+				if (code == 0 && resp.Errors[k] != nil) || (code != 0 && (resp.Errors[k] == nil || resp.Errors[k].Code != code)) {
+					t.Fatal("errors不正确", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// readCountReader 记录读取的次数
+type readCountReader struct {
+	reader io.Reader
+	reads  int
+}
+
+func (r *readCountReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.reader.Read(p)
+}
+
+func TestHandlerAuthorize(t *testing.T) {
+	for _, mode := range []HandlerMode{HandleSingle, HandleMultiple, HandleStream} {
+		storage := &MemoryStorage{}
+		h := NewHandler(Uploader{
+			FieldName: "file",
+			MaxSize:   1,
+			AllowMIME: []string{"text/plain"},
+			Storage:   storage,
+		}, HandlerOptions{Mode: mode, Authorize: func(r *http.Request) error {
+			if r.Header.Get("Authorization") == "" {
+				return errors.New("未登录")
+			}
+			return nil
+		}})
+
+		req := uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello"))
+		body := &readCountReader{reader: req.Body}
+		req.Body = ioutil.NopCloser(body)
+		w, resp := serve(t, h, req)
+		if w.Code != http.StatusForbidden || resp.Error == nil || resp.Error.Code != ErrForbidden {
+			t.Fatal(mode, "应响应403", w.Code, w.Body.String())
+		}
+		if body.reads > 0 {
+			t.Fatal(mode, "权限检查失败时不应读取请求体")
+		}
+		if names, _ := storage.List(""); len(names) > 0 {
+			t.Fatal(mode, "不应写入文件", names)
+		}
+
+		req = uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello"))
+		req.Header.Set("Authorization", "token")
+		if w, _ = serve(t, h, req); w.Code != http.StatusOK {
+			t.Fatal(mode, "应上传成功", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandlerSubPath(t *testing.T) {
+	storage := &MemoryStorage{}
+	h := NewHandler(Uploader{
+		FieldName:   "file",
+		MaxSize:     1,
+		AllowMIME:   []string{"text/plain"},
+		SaveSubPath: "default",
+		Storage:     storage,
+	}, HandlerOptions{SubPath: func(r *http.Request) (string, error) {
+		user := r.URL.Query().Get("user")
+		if user == "" {
+			return "", errors.New("缺少user参数")
+		}
+		return "users/" + user, nil
+	}})
+
+	// 每个请求使用SubPath生成的目录，不影响模板
+	for _, user := range []string{"1", "2"} {
+		w, resp := serve(t, h, uploadertest.NewRequest("/?user="+user, uploadertest.Text("file", "a.txt", "hello "+user)))
+		if w.Code != http.StatusOK || len(resp.Results) != 1 {
+			t.Fatal("应上传成功", w.Code, w.Body.String())
+		}
+		if data, ok := storage.Get("users/" + user + "/" + resp.Results[0].FileName); !ok || string(data) != "hello "+user {
+			names, _ := storage.List("")
+			t.Fatal("文件应保存到SubPath生成的目录", names)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "SubPath返回错误", target: "/"},
+		{name: "SubPath包含..", target: "/?user=../../etc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := serve(t, h, uploadertest.NewRequest(tt.target, uploadertest.Text("file", "a.txt", "hello")))
+			if w.Code != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != ErrInvalidPath {
+				t.Fatal("应响应400", w.Code, w.Body.String())
+			}
+		})
+	}
+	if names, _ := storage.List(""); len(names) != 2 {
+		t.Fatal("只应保存2个文件", names)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	if _, _, ok := ResultsFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Fatal("请求上下文中不应有上传结果")
+	}
+
+	var (
+		called   bool
+		results  []Result
+		fileErrs []Error
+	)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		called = true
+		if results, fileErrs, ok = ResultsFromContext(r.Context()); !ok {
+			t.Fatal("请求上下文中应有上传结果")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := Middleware(Uploader{
+		FieldName: "file",
+		MaxSize:   1,
+		AllowMIME: []string{"text/plain"},
+		Storage:   &MemoryStorage{},
+	}, HandlerOptions{Mode: HandleMultiple})(next)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello"), uploadertest.Bytes("file", "b.html", []byte("<html><body>hello</body></html>"))))
+	if !called || w.Code != http.StatusCreated {
+		t.Fatal("应调用next", w.Code, w.Body.String())
+	}
+	if len(results) != 2 || len(fileErrs) != 2 || results[0].OriginalName != "a.txt" || fileErrs[0].Status != 0 || !errors.Is(fileErrs[1], ErrMIMERejected) {
+		t.Fatalf("上传结果不正确: %+v %+v", results, fileErrs)
+	}
+
+	// 整体性的错误直接响应，不调用next
+	called = false
+	w, resp := serve(t, h, uploadertest.NewRequest("/", uploadertest.Text("other", "a.txt", "hello")))
+	if called || w.Code != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != ErrNoFile {
+		t.Fatal("不应调用next", w.Code, w.Body.String())
+	}
+}
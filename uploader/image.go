@@ -0,0 +1,356 @@
+package uploader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/dxvgef/gommon/encrypt"
+)
+
+// 未限制最大尺寸时允许解码的最大像素数（GIF为所有帧的像素总数），防止解压炸弹
+const maxImagePixels = 100000000
+
+// 重新编码GIF时允许的最大帧数
+const maxGIFFrames = 5000
+
+type (
+	// ImageOptions 图片处理参数，仅对JPEG、PNG、GIF文件生效
+	ImageOptions struct {
+		MinWidth      int         // 最小宽度（像素），0表示不限制
+		MinHeight     int         // 最小高度（像素），0表示不限制
+		MaxWidth      int         // 最大宽度（像素），0表示不限制
+		MaxHeight     int         // 最大高度（像素），0表示不限制
+		StripMetadata bool        // 重新编码原图以去除EXIF等元数据，JPEG会因此产生一次有损压缩
+		JPEGQuality   int         // 编码JPEG时的质量（1-100），0则使用jpeg.DefaultQuality
+		Thumbnails    []Thumbnail // 需要生成的缩略图
+	}
+	// Thumbnail 缩略图参数，按比例缩放到Width x Height以内，不会放大
+	Thumbnail struct {
+		Name   string // 缩略图名称，存储文件名为"原文件名_Name.后缀名"
+		Width  int    // 最大宽度（像素），0表示按Height等比缩放
+		Height int    // 最大高度（像素），0表示按Width等比缩放
+	}
+	// Variant 上传后生成的图片变体
+	Variant struct {
+		Name     string `json:"name"`          // 缩略图名称
+		FileName string `json:"file_name"`     // 文件名（相对SaveSubPath）
+		FileSize int64  `json:"file_size"`     // 文件大小
+		Width    int    `json:"width"`         // 宽度（像素）
+		Height   int    `json:"height"`        // 高度（像素）
+		URL      string `json:"url,omitempty"` // 文件的访问地址，由存储后端生成
+	}
+	// processedImage 图片处理的结果
+	processedImage struct {
+		width      int
+		height     int
+		file       *os.File // 重新编码后的原图（临时文件），未重新编码时为nil
+		size       int64    // 重新编码后的原图大小
+		sha256     string   // 重新编码后的原图的SHA-256值
+		thumbnails []thumbnailData
+	}
+	thumbnailData struct {
+		name   string
+		data   []byte
+		width  int
+		height int
+	}
+)
+
+// isImageMIME 判断是否为可处理的图片格式
+func isImageMIME(mimeType string) bool {
+	return mimeType == "image/jpeg" || mimeType == "image/png" || mimeType == "image/gif"
+}
+
+// processImage 检查图片尺寸、重新编码原图并生成缩略图，src必须位于文件开头
+func (obj *Uploader) processImage(src io.ReadSeeker, mimeType string) (output processedImage, execErr Error) {
+	opts := obj.Image
+
+	// 先读取尺寸再解码，避免解码超大图片
+	config, _, err := image.DecodeConfig(src)
+	if err != nil {
+		execErr = obj.newError(ErrInvalidImage, 400, err)
+		return
+	}
+	output.width, output.height = config.Width, config.Height
+	if (opts.MinWidth > 0 && config.Width < opts.MinWidth) || (opts.MinHeight > 0 && config.Height < opts.MinHeight) ||
+		(opts.MaxWidth > 0 && config.Width > opts.MaxWidth) || (opts.MaxHeight > 0 && config.Height > opts.MaxHeight) ||
+		int64(config.Width)*int64(config.Height) > maxImagePixels {
+		execErr = obj.newError(ErrImageSize, 400, errors.New("图片尺寸("+strconv.Itoa(config.Width)+"x"+strconv.Itoa(config.Height)+")不符合要求"))
+		return
+	}
+	if !opts.StripMetadata && len(opts.Thumbnails) == 0 {
+		return
+	}
+
+	// 解码图片
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		execErr = obj.newError(ErrStorageFailed, 500, err)
+		return
+	}
+	var (
+		img     image.Image
+		gifData *gif.GIF
+	)
+	if mimeType == "image/gif" && opts.StripMetadata {
+		// 重新编码GIF需要解码所有帧，先扫描数据块检查帧数和像素总数
+		frames, pixels, scanErr := gifFrames(src)
+		if scanErr != nil {
+			execErr = obj.newError(ErrInvalidImage, 400, scanErr)
+			return
+		}
+		if frames > maxGIFFrames || pixels > maxImagePixels {
+			execErr = obj.newError(ErrImageSize, 400, errors.New("GIF图片的帧数("+strconv.Itoa(frames)+")或像素总数("+strconv.FormatInt(pixels, 10)+")超出限制"))
+			return
+		}
+		if _, err = src.Seek(0, io.SeekStart); err != nil {
+			execErr = obj.newError(ErrStorageFailed, 500, err)
+			return
+		}
+		if gifData, err = gif.DecodeAll(src); err == nil {
+			img = gifData.Image[0]
+		}
+	} else {
+		// 只生成缩略图时GIF只解码第一帧
+		img, _, err = image.Decode(src)
+	}
+	if err != nil {
+		execErr = obj.newError(ErrInvalidImage, 400, err)
+		return
+	}
+
+	// 重新编码原图
+	if opts.StripMetadata {
+		if output.file, err = obj.tempFile(); err == nil {
+			hash := encrypt.NewSHA256()
+			w := io.MultiWriter(output.file, hash)
+			if gifData != nil {
+				err = gif.EncodeAll(w, gifData)
+			} else {
+				err = obj.encodeImage(w, img, mimeType)
+			}
+			if err == nil {
+				output.size, err = output.file.Seek(0, io.SeekCurrent)
+			}
+			if err == nil {
+				_, err = output.file.Seek(0, io.SeekStart)
+			}
+			output.sha256 = hex.EncodeToString(hash.Sum(nil))
+		}
+		if err != nil {
+			if output.file != nil {
+				closeSpool(output.file)
+				output.file = nil
+			}
+			execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("重新编码图片失败: %w", err))
+			return
+		}
+	}
+
+	// 生成缩略图
+	for k := range opts.Thumbnails {
+		width, height := fitSize(output.width, output.height, opts.Thumbnails[k].Width, opts.Thumbnails[k].Height)
+		var buf bytes.Buffer
+		if err = obj.encodeImage(&buf, resizeImage(img, width, height), mimeType); err != nil {
+			if output.file != nil {
+				closeSpool(output.file)
+				output.file = nil
+			}
+			execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("生成缩略图失败: %w", err))
+			return
+		}
+		output.thumbnails = append(output.thumbnails, thumbnailData{
+			name:   opts.Thumbnails[k].Name,
+			data:   buf.Bytes(),
+			width:  width,
+			height: height,
+		})
+	}
+	return
+}
+
+// gifFrames 扫描GIF文件的数据块，不解码图像数据，返回帧数和所有帧的像素总数
+func gifFrames(r io.Reader) (frames int, pixels int64, err error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, 13)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return
+	}
+	// 全局颜色表
+	if header[10]&0x80 != 0 {
+		if _, err = reader.Discard(3 << (header[10]&7 + 1)); err != nil {
+			return
+		}
+	}
+	descriptor := make([]byte, 9)
+	for {
+		var c byte
+		if c, err = reader.ReadByte(); err != nil {
+			return
+		}
+		switch c {
+		case 0x21:
+			// 扩展块：标签和数据子块
+			if _, err = reader.ReadByte(); err != nil {
+				return
+			}
+		case 0x2C:
+			// 图像描述符、局部颜色表、LZW编码长度和图像数据子块
+			if _, err = io.ReadFull(reader, descriptor); err != nil {
+				return
+			}
+			frames++
+			pixels += (int64(descriptor[4]) | int64(descriptor[5])<<8) * (int64(descriptor[6]) | int64(descriptor[7])<<8)
+			if descriptor[8]&0x80 != 0 {
+				if _, err = reader.Discard(3 << (descriptor[8]&7 + 1)); err != nil {
+					return
+				}
+			}
+			if _, err = reader.ReadByte(); err != nil {
+				return
+			}
+		case 0x3B:
+			return
+		default:
+			err = errors.New("无效的GIF数据块")
+			return
+		}
+		if err = skipGIFSubBlocks(reader); err != nil {
+			return
+		}
+	}
+}
+
+// skipGIFSubBlocks 跳过数据子块直到长度为0的结束块
+func skipGIFSubBlocks(reader *bufio.Reader) error {
+	for {
+		size, err := reader.ReadByte()
+		if err != nil || size == 0 {
+			return err
+		}
+		if _, err = reader.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// putThumbnails 将缩略图写入存储后端，write为false时只生成Variant，出错时删除已写入的缩略图
+func (obj *Uploader) putThumbnails(storage Storage, saveName, suffix, mimeType string, thumbnails []thumbnailData, write bool) (variants []Variant, err error) {
+	var names []string
+	for k := range thumbnails {
+		var name string
+		thumbName := saveName + "_" + thumbnails[k].name
+		if name, err = safeName(obj.SaveSubPath, thumbName, suffix); err == nil && write {
+			err = storage.Put(name, bytes.NewReader(thumbnails[k].data), PutOptions{
+				Size:        int64(len(thumbnails[k].data)),
+				MIME:        mimeType,
+				NoOverwrite: obj.Overwrite != OverwriteReplace,
+			})
+		}
+		if err != nil {
+			for i := range names {
+				_ = storage.Delete(names[i])
+			}
+			return nil, err
+		}
+		names = append(names, name)
+		variants = append(variants, Variant{
+			Name:     thumbnails[k].name,
+			FileName: relativeName(thumbName, suffix),
+			FileSize: int64(len(thumbnails[k].data)),
+			Width:    thumbnails[k].width,
+			Height:   thumbnails[k].height,
+			URL:      storage.URL(name),
+		})
+	}
+	return
+}
+
+// encodeImage 按MIME值编码图片
+func (obj *Uploader) encodeImage(w io.Writer, img image.Image, mimeType string) error {
+	switch mimeType {
+	case "image/jpeg":
+		quality := obj.Image.JPEGQuality
+		if quality <= 0 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "image/png":
+		return png.Encode(w, img)
+	case "image/gif":
+		return gif.Encode(w, img, nil)
+	}
+	return errors.New("不支持编码" + mimeType + "类型的图片")
+}
+
+// fitSize 计算等比缩放到maxWidth x maxHeight以内的尺寸，不会放大
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return width, height
+	}
+	if maxWidth <= 0 || maxWidth > width {
+		maxWidth = width
+	}
+	if maxHeight <= 0 || maxHeight > height {
+		maxHeight = height
+	}
+	// 按缩放比例较小的一边计算
+	if int64(maxWidth)*int64(height) <= int64(maxHeight)*int64(width) {
+		h := int(int64(height) * int64(maxWidth) / int64(width))
+		if h < 1 {
+			h = 1
+		}
+		return maxWidth, h
+	}
+	w := int(int64(width) * int64(maxHeight) / int64(height))
+	if w < 1 {
+		w = 1
+	}
+	return w, maxHeight
+}
+
+// resizeImage 使用区域平均的方式将图片缩小到指定尺寸
+func resizeImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return src
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
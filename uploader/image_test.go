@@ -0,0 +1,77 @@
+package uploader
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+// craftedGIF 构造只有数据块结构的GIF文件，图像数据无法解码
+func craftedGIF(width, height, frames int) []byte {
+	var buf bytes.Buffer
+	uint16LE := func(v int) {
+		buf.WriteByte(byte(v))
+		buf.WriteByte(byte(v >> 8))
+	}
+	buf.WriteString("GIF89a")
+	uint16LE(width)
+	uint16LE(height)
+	buf.Write([]byte{0, 0, 0})
+	for i := 0; i < frames; i++ {
+		buf.WriteByte(0x2C)
+		uint16LE(0)
+		uint16LE(0)
+		uint16LE(width)
+		uint16LE(height)
+		buf.WriteByte(0)
+		buf.Write([]byte{2, 1, 0, 0})
+	}
+	buf.WriteByte(0x3B)
+	return buf.Bytes()
+}
+
+func TestGIFFrames(t *testing.T) {
+	animation := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 4, 3), palette.Plan9))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	frames, pixels, err := gifFrames(bytes.NewReader(buf.Bytes()))
+	if err != nil || frames != 3 || pixels != 36 {
+		t.Fatal("帧数或像素总数不正确", frames, pixels, err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// 每帧都不超出限制，但像素总数超出
+		{name: "像素总数超出限制", data: craftedGIF(10000, 10000, 2)},
+		{name: "帧数超出限制", data: craftedGIF(1, 1, maxGIFFrames+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := Uploader{
+				FieldName: "file",
+				MaxSize:   1024,
+				AllowMIME: []string{"image/gif"},
+				Image:     &ImageOptions{StripMetadata: true},
+				Storage:   &MemoryStorage{},
+				Request:   uploadertest.NewRequest("/", uploadertest.Bytes("file", "a.gif", tt.data)),
+			}
+			_, execErr := obj.Exec()
+			if !errors.Is(execErr, ErrImageSize) || execErr.Status != 400 {
+				t.Fatalf("应返回%d(400)，实际为%d(%d): %v", ErrImageSize, execErr.Code, execErr.Status, execErr)
+			}
+		})
+	}
+}
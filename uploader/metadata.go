@@ -0,0 +1,161 @@
+package uploader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// 元数据文件的后缀，元数据文件与上传的文件存放在同一目录中，例如a.jpg的元数据文件为a.jpg.meta.json
+const metadataSuffix = ".meta.json"
+
+type (
+	// Lister 可以列出文件的存储后端
+	Lister interface {
+		// List 列出prefix目录（包括子目录）中的所有文件，返回相对于存储根的路径
+		List(prefix string) ([]string, error)
+	}
+	// Opener 可以读取文件的存储后端
+	Opener interface {
+		// Open 打开文件，文件不存在时返回的错误满足errors.Is(err, os.ErrNotExist)
+		Open(name string) (io.ReadCloser, error)
+	}
+	// Metadata 上传文件的元数据
+	Metadata struct {
+		Name         string   `json:"name"`               // 文件在存储中的路径（相对于存储根）
+		FieldName    string   `json:"field_name"`         // 上传控件的name值
+		OriginalName string   `json:"original_name"`      // 客户端提交的原始文件名
+		FileSize     int64    `json:"file_size"`          // 文件大小
+		FileMIME     string   `json:"file_mime"`          // 文件的MIME值（按文件内容识别）
+		SHA256       string   `json:"sha256"`             // 文件内容的SHA-256值（hex）
+		Owner        string   `json:"owner,omitempty"`    // 上传者标识
+		Width        int      `json:"width,omitempty"`    // 图片宽度（像素）
+		Height       int      `json:"height,omitempty"`   // 图片高度（像素）
+		Variants     []string `json:"variants,omitempty"` // 缩略图在存储中的路径
+		CreatedAt    int64    `json:"created_at"`         // 上传时间（unix时间）
+	}
+)
+
+// putMetadata 写入上传文件的元数据文件
+func (obj *Uploader) putMetadata(storage Storage, name string, result *Result) error {
+	metadata := Metadata{
+		Name:         name,
+		FieldName:    result.FieldName,
+		OriginalName: result.OriginalName,
+		FileSize:     result.FileSize,
+		FileMIME:     result.FileMIME,
+		SHA256:       result.SHA256,
+		Owner:        obj.Owner,
+		Width:        result.Width,
+		Height:       result.Height,
+		Variants:     obj.variantNames(result.Variants),
+		CreatedAt:    time.Now().Unix(),
+	}
+	data, err := json.Marshal(&metadata)
+	if err != nil {
+		return err
+	}
+	return storage.Put(name+metadataSuffix, bytes.NewReader(data), PutOptions{
+		Size: int64(len(data)),
+		MIME: "application/json",
+	})
+}
+
+// variantNames 获得缩略图在存储中的路径
+func (obj *Uploader) variantNames(variants []Variant) (names []string) {
+	for k := range variants {
+		// 缩略图写入时已校验过路径
+		if name, err := safeName(obj.SaveSubPath, variants[k].FileName, ""); err == nil {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// ReadMetadata 读取上传文件的元数据，name为文件在存储中的路径，存储后端必须实现Opener
+func ReadMetadata(storage Storage, name string) (metadata Metadata, err error) {
+	opener, ok := storage.(Opener)
+	if !ok {
+		err = errors.New("存储后端不支持读取文件")
+		return
+	}
+	r, err := opener.Open(strings.TrimLeft(path.Clean("/"+name), "/") + metadataSuffix)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &metadata)
+	return
+}
+
+// ListUploads 列出subPath目录（包括子目录）中所有写入了元数据的上传文件，存储后端必须实现Lister和Opener
+func ListUploads(storage Storage, subPath string) (list []Metadata, err error) {
+	lister, ok := storage.(Lister)
+	if !ok {
+		return nil, errors.New("存储后端不支持列出文件")
+	}
+	names, err := lister.List(subPath)
+	if err != nil {
+		return
+	}
+	for k := range names {
+		if !strings.HasSuffix(names[k], metadataSuffix) {
+			continue
+		}
+		metadata, err := ReadMetadata(storage, strings.TrimSuffix(names[k], metadataSuffix))
+		if err != nil {
+			// 列出的过程中文件可能已被删除
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		list = append(list, metadata)
+	}
+	return
+}
+
+// DeleteUpload 删除上传文件及其缩略图和元数据文件，name为文件在存储中的路径
+// 存储后端未实现Opener或没有元数据文件时，只删除文件本身
+// 元数据中的缩略图只有与文件位于同一目录且文件名以“存储文件名_”开头时才会删除
+func DeleteUpload(storage Storage, name string) error {
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+	metadata, err := ReadMetadata(storage, name)
+	if err == nil {
+		for k := range metadata.Variants {
+			if !isVariantOf(name, metadata.Variants[k]) {
+				continue
+			}
+			if err = storage.Delete(metadata.Variants[k]); err != nil {
+				return err
+			}
+		}
+	}
+	if err = storage.Delete(name); err != nil {
+		return err
+	}
+	// 最后删除元数据文件，中途出错时仍可重试
+	return storage.Delete(name + metadataSuffix)
+}
+
+// isVariantOf 判断variant是否为文件name的缩略图，缩略图的文件名为“存储文件名_缩略图名称.后缀名”
+func isVariantOf(name, variant string) bool {
+	variant = strings.TrimLeft(path.Clean("/"+variant), "/")
+	if path.Dir(variant) != path.Dir(name) {
+		return false
+	}
+	base := path.Base(name)
+	return strings.HasPrefix(path.Base(variant), strings.TrimSuffix(base, path.Ext(base))+"_")
+}
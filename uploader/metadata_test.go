@@ -0,0 +1,35 @@
+package uploader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeleteUpload(t *testing.T) {
+	storage := &MemoryStorage{}
+	put := func(name, data string) {
+		if err := storage.Put(name, strings.NewReader(data), PutOptions{Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("s/a.jpg", "a")
+	put("s/a_small.jpg", "small")
+	put("s/b.jpg", "b")
+	put("other/important.bin", "important")
+	// 伪造的元数据只能删除同一目录中以a_开头的缩略图
+	put("s/a.jpg"+metadataSuffix, `{"variants":["s/a_small.jpg","other/important.bin","s/b.jpg","s/../other/important.bin"]}`)
+
+	if err := DeleteUpload(storage, "s/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"s/a.jpg", "s/a_small.jpg", "s/a.jpg" + metadataSuffix} {
+		if ok, _ := storage.Exists(name); ok {
+			t.Fatal("文件未删除", name)
+		}
+	}
+	for _, name := range []string{"s/b.jpg", "other/important.bin"} {
+		if ok, _ := storage.Exists(name); !ok {
+			t.Fatal("不应删除", name)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package uploader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dxvgef/gommon/random"
+)
+
+// 清理后的文件名最大长度（字节）
+const maxFileNameLen = 200
+
+// NameStrategy 存储文件名的生成策略，仅在SaveName为空时生效
+type NameStrategy uint8
+
+const (
+	NameOriginal  NameStrategy = iota // 清理后的原始文件名（默认）
+	NameUUID                          // 随机UUID
+	NameHash                          // 文件内容的SHA-256值
+	NameTimestamp                     // 时间+随机字符串
+	NameCustom                        // 使用NameFunc生成
+)
+
+// NameInfo 生成存储文件名时可用的文件信息
+type NameInfo struct {
+	OriginalName string // 客户端提交的原始文件名
+	MIME         string // 文件的MIME值
+	Suffix       string // 存储文件的后缀名
+	SHA256       string // 文件内容的SHA-256值（hex），仅在NameHash策略下有值
+}
+
+// NameFunc 自定义的命名函数，返回存储文件名（不含后缀名）
+type NameFunc func(info NameInfo) (string, error)
+
+// Windows的保留设备名
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// SanitizeFileName 清理客户端提交的文件名，去除目录部分，仅保留字母、数字、-、_和.，
+// 其它字符（包括各种Unicode斜杠、控制字符、零宽字符和双向文本控制符）替换为_
+func SanitizeFileName(name string) string {
+	// 去除目录部分
+	if pos := strings.LastIndexAny(name, `/\`); pos >= 0 {
+		name = name[pos+1:]
+	}
+	if !utf8.ValidString(name) {
+		name = strings.ToValidUTF8(name, "_")
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == '-' || r == '_' || r == '.':
+			b.WriteRune(r)
+		case unicode.Is(unicode.Cf, r):
+			// 丢弃零宽字符、双向文本控制符等格式字符
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name = strings.TrimLeft(b.String(), ".")
+	name = strings.TrimRight(name, ". ")
+
+	// 限制长度，保留扩展名
+	if len(name) > maxFileNameLen {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := name[:maxFileNameLen-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+
+	base := strings.TrimSuffix(name, path.Ext(name))
+	for k := range reservedNames {
+		if strings.EqualFold(base, reservedNames[k]) {
+			name = "_" + name
+			break
+		}
+	}
+	return name
+}
+
+// newUUID 生成随机UUID（版本4）
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// makeName 按NameStrategy生成存储文件名（不含后缀名）
+func (obj *Uploader) makeName(info NameInfo) (name string, err error) {
+	switch obj.NameStrategy {
+	case NameOriginal:
+		name = SanitizeFileName(info.OriginalName)
+		name = strings.TrimSuffix(name, path.Ext(name))
+	case NameUUID:
+		name, err = newUUID()
+	case NameHash:
+		name = shardName(info.SHA256, obj.HashShard)
+	case NameTimestamp:
+		name = time.Now().Format("20060102150405") + "_" + random.Lower(8)
+	case NameCustom:
+		if obj.NameFunc == nil {
+			return "", errors.New("NameStrategy为NameCustom时必须指定NameFunc")
+		}
+		name, err = obj.NameFunc(info)
+	default:
+		return "", errors.New("无效的NameStrategy")
+	}
+	if err != nil {
+		return
+	}
+	// 原始文件名清理后可能为空
+	if name == "" {
+		name, err = newUUID()
+	}
+	return
+}
+
+// shardName 将哈希值拆分为多级目录，每级2个字符，例如levels为2时abcdef...转为ab/cd/abcdef...
+func shardName(hash string, levels int) string {
+	if levels*2 >= len(hash) {
+		levels = 0
+	}
+	var b strings.Builder
+	for i := 0; i < levels; i++ {
+		b.WriteString(hash[i*2 : i*2+2])
+		b.WriteByte('/')
+	}
+	b.WriteString(hash)
+	return b.String()
+}
+
+// fileSuffix 获得存储文件的后缀名，原始文件名没有扩展名时使用MIME值对应的扩展名
+func fileSuffix(fileName, mimeType string) string {
+	suffix := strings.ToLower(strings.TrimPrefix(path.Ext(SanitizeFileName(fileName)), "."))
+	if suffix == "" {
+		if exts := mimeExtensions[mimeType]; len(exts) > 0 {
+			suffix = exts[0]
+		}
+	}
+	return suffix
+}
+
+// relativeName 获得相对于SaveSubPath的存储文件名
+func relativeName(saveName, suffix string) string {
+	name := strings.TrimLeft(path.Clean("/"+saveName), "/")
+	if suffix != "" {
+		name += "." + suffix
+	}
+	return name
+}
+
+// safeName 拼接存储子路径、文件名和后缀名，并确保结果不会超出存储根路径
+func safeName(subPath, name, suffix string) (string, error) {
+	if suffix != "" {
+		name += "." + suffix
+	}
+	full := subPath + "/" + name
+	if strings.ContainsAny(full, "\\\x00") || strings.HasSuffix(name, "/") {
+		return "", errors.New("文件路径不合法 " + full)
+	}
+	elems := strings.Split(full, "/")
+	for k := range elems {
+		if elems[k] == ".." {
+			return "", errors.New("文件路径不合法 " + full)
+		}
+	}
+	result := strings.TrimLeft(path.Clean("/"+full), "/")
+	if result == "" {
+		return "", errors.New("文件路径不合法 " + full)
+	}
+	// 不允许覆盖元数据文件
+	if strings.HasSuffix(strings.ToLower(result), metadataSuffix) {
+		return "", errors.New("文件名不能以" + metadataSuffix + "结尾 " + full)
+	}
+	return result, nil
+}
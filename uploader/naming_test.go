@@ -0,0 +1,190 @@
+package uploader
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"a.txt", "a.txt"},
+		{"../../etc/passwd", "passwd"},
+		{`..\..\windows\win.ini`, "win.ini"},
+		{"a/../b.txt", "b.txt"},
+		{"..", ""},
+		{"\uff0fetc\uff0fpasswd", "_etc_passwd"},
+		{"a\u202etxt.exe", "atxt.exe"},
+		{"a\u200bb\ufeff.txt", "ab.txt"},
+		{"a b?*:<>|.txt", "a_b______.txt"},
+		{"报告 v1.txt", "报告_v1.txt"},
+		{"a\x00\n.txt", "a__.txt"},
+		{"\xff.txt", "_.txt"},
+		{"file...", "file"},
+		{"file. .", "file._"},
+		{"CON", "_CON"},
+		{"con.txt", "_con.txt"},
+		{"LPT9.log", "_LPT9.log"},
+		{"CONSOLE.txt", "CONSOLE.txt"},
+		// 去除开头的.，避免生成隐藏文件，因此只有扩展名的文件名不再有扩展名
+		{".txt", "txt"},
+		{".htaccess", "htaccess"},
+	}
+	for _, tt := range tests {
+		if name := SanitizeFileName(tt.name); name != tt.expected {
+			t.Errorf("SanitizeFileName(%q)应为%q，实际为%q", tt.name, tt.expected, name)
+		}
+	}
+
+	// 超长的文件名截断后保留扩展名，且不会截断多字节字符
+	for _, name := range []string{strings.Repeat("a", 300) + ".txt", strings.Repeat("中", 100) + ".txt", strings.Repeat("中", 100) + "." + strings.Repeat("x", 20)} {
+		result := SanitizeFileName(name)
+		if len(result) > maxFileNameLen || !utf8.ValidString(result) {
+			t.Fatalf("截断后的文件名不正确: %q", result)
+		}
+		if strings.HasSuffix(name, ".txt") && !strings.HasSuffix(result, ".txt") {
+			t.Fatalf("截断后应保留扩展名: %q", result)
+		}
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	tests := []struct {
+		subPath, name, suffix string
+		expected              string // 为空表示应返回错误
+	}{
+		{"sub", "a", "txt", "sub/a.txt"},
+		{"", "a", "", "a"},
+		{"/abs/path/", "a", "txt", "abs/path/a.txt"},
+		{"sub", "ab/cd/abcd", "png", "sub/ab/cd/abcd.png"},
+		{"sub", "../a", "txt", ""},
+		{"sub", "a/../../b", "txt", ""},
+		{"../sub", "a", "txt", ""},
+		{"/../sub", "a", "txt", ""},
+		{"sub", `..\a`, "txt", ""},
+		{"sub", "a\x00", "txt", ""},
+		{"sub", "dir/", "", ""},
+		{"", "", "", ""},
+		{"sub", "a.META.JSON", "", ""},
+		{"sub", "a", "meta.json", ""},
+	}
+	for _, tt := range tests {
+		result, err := safeName(tt.subPath, tt.name, tt.suffix)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("safeName(%q, %q, %q)应返回错误，实际为%q", tt.subPath, tt.name, tt.suffix, result)
+			}
+			continue
+		}
+		if err != nil || result != tt.expected {
+			t.Errorf("safeName(%q, %q, %q)应为%q，实际为%q: %v", tt.subPath, tt.name, tt.suffix, tt.expected, result, err)
+		}
+	}
+}
+
+func TestMakeName(t *testing.T) {
+	const hash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	tests := []struct {
+		name     string
+		obj      Uploader
+		info     NameInfo
+		expected string         // 与match二选一
+		match    *regexp.Regexp // 为nil时比较expected
+		err      bool
+	}{
+		{name: "原始文件名", info: NameInfo{OriginalName: `..\x/报告 v1.txt`}, expected: "报告_v1"},
+		{name: "原始文件名清理后为空", info: NameInfo{OriginalName: "../.."}, match: uuid},
+		{name: "原始文件名只有扩展名", info: NameInfo{OriginalName: ".txt"}, expected: "txt"},
+		{name: "UUID", obj: Uploader{NameStrategy: NameUUID}, match: uuid},
+		{name: "哈希值", obj: Uploader{NameStrategy: NameHash}, info: NameInfo{SHA256: hash}, expected: hash},
+		{name: "分级的哈希值", obj: Uploader{NameStrategy: NameHash, HashShard: 2}, info: NameInfo{SHA256: hash}, expected: "b9/4d/" + hash},
+		{name: "时间", obj: Uploader{NameStrategy: NameTimestamp}, match: regexp.MustCompile(`^\d{14}_[a-z]{8}$`)},
+		{name: "自定义", obj: Uploader{NameStrategy: NameCustom, NameFunc: func(info NameInfo) (string, error) {
+			return "custom_" + info.Suffix, nil
+		}}, info: NameInfo{Suffix: "txt"}, expected: "custom_txt"},
+		{name: "未指定NameFunc", obj: Uploader{NameStrategy: NameCustom}, err: true},
+		{name: "无效的策略", obj: Uploader{NameStrategy: 99}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := tt.obj.makeName(tt.info)
+			if tt.err {
+				if err == nil {
+					t.Fatal("应返回错误", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tt.match != nil && !tt.match.MatchString(name)) || (tt.match == nil && name != tt.expected) {
+				t.Fatal("文件名不正确", name)
+			}
+		})
+	}
+}
+
+func TestExecNamePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(obj *Uploader)
+		fileName string
+		expected string // 为空表示应返回ErrInvalidPath
+	}{
+		{name: "路径穿越的原始文件名", fileName: "../../a.txt", expected: "sub/a.txt"},
+		{name: "只有扩展名的原始文件名", fileName: ".txt", expected: "sub/txt"},
+		{name: "自定义文件名包含..", fileName: "a.txt", prepare: func(obj *Uploader) {
+			obj.NameStrategy = NameCustom
+			obj.NameFunc = func(NameInfo) (string, error) {
+				return "../../evil", nil
+			}
+		}},
+		{name: "SaveName包含..", fileName: "a.txt", prepare: func(obj *Uploader) {
+			obj.SaveName = "../evil"
+		}},
+		{name: "SaveSubPath包含..", fileName: "a.txt", prepare: func(obj *Uploader) {
+			obj.SaveSubPath = "sub/../../evil"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &MemoryStorage{}
+			obj := Uploader{
+				FieldName:   "file",
+				MaxSize:     1,
+				AllowMIME:   []string{"text/plain"},
+				SaveSubPath: "sub",
+				Storage:     storage,
+				Request:     uploadertest.NewRequest("/", uploadertest.Text("file", tt.fileName, "hello")),
+			}
+			if tt.prepare != nil {
+				tt.prepare(&obj)
+			}
+			_, execErr := obj.Exec()
+			if tt.expected == "" {
+				if !errors.Is(execErr, ErrInvalidPath) || execErr.Status != 400 {
+					t.Fatalf("应返回%d(400)，实际为%d(%d): %v", ErrInvalidPath, execErr.Code, execErr.Status, execErr)
+				}
+				if names, _ := storage.List(""); len(names) > 0 {
+					t.Fatal("不应写入文件", names)
+				}
+				return
+			}
+			if execErr.Status != 0 {
+				t.Fatal(execErr)
+			}
+			if ok, _ := storage.Exists(tt.expected); !ok {
+				names, _ := storage.List("")
+				t.Fatal("文件应保存为", tt.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type (
+	// Progress 写入存储后端的进度
+	Progress struct {
+		OriginalName string  // 客户端提交的原始文件名
+		Written      int64   // 已写入的字节数
+		Total        int64   // 文件大小，-1表示未知
+		Percent      float64 // 已写入的百分比（0-100），文件大小未知时为-1
+	}
+	// RateLimiter 限速器，可在多个上传实例之间共享以限制总带宽（如同一租户的所有上传）
+	RateLimiter struct {
+		rate  int64 // 每秒字节数
+		mutex sync.Mutex
+		next  time.Time // 已分配的配额用完的时间
+	}
+	// progressReader 在读取数据时限速并报告进度
+	progressReader struct {
+		ctx      context.Context
+		reader   io.Reader
+		limiter  *RateLimiter
+		callback func(Progress)
+		channel  chan<- Progress
+		progress Progress
+	}
+)
+
+// NewRateLimiter 创建限速器，bytesPerSecond为每秒允许写入的字节数
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{rate: bytesPerSecond}
+}
+
+// wait 等待n个字节的配额，ctx结束时归还配额并返回ctx.Err()
+func (l *RateLimiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 || n <= 0 {
+		return nil
+	}
+	quota := time.Duration(int64(n) * int64(time.Second) / l.rate)
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(quota)
+	delay := l.next.Sub(now)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		l.next = l.next.Add(-quota)
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// maxRead 单次读取的最大字节数，避免一次读取的数据过多导致长时间等待
+func (l *RateLimiter) maxRead() int {
+	if l.rate < 1024 {
+		return 1024
+	}
+	if l.rate > 1<<20 {
+		return 1 << 20
+	}
+	return int(l.rate)
+}
+
+// wrapProgress 按RateLimiter、OnProgress和ProgressChan包装写入存储后端的数据，均未设置时返回原reader
+// ctx结束时等待限速的读取会立即返回ctx.Err()
+func (obj *Uploader) wrapProgress(ctx context.Context, r io.Reader, originalName string, total int64) io.Reader {
+	if obj.RateLimiter == nil && obj.OnProgress == nil && obj.ProgressChan == nil {
+		return r
+	}
+	if total <= 0 {
+		total = -1
+	}
+	return &progressReader{
+		ctx:      ctx,
+		reader:   r,
+		limiter:  obj.RateLimiter,
+		callback: obj.OnProgress,
+		channel:  obj.ProgressChan,
+		progress: Progress{OriginalName: originalName, Total: total, Percent: -1},
+	}
+}
+
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	if r.limiter != nil && len(p) > r.limiter.maxRead() {
+		p = p[:r.limiter.maxRead()]
+	}
+	n, err = r.reader.Read(p)
+	if n <= 0 {
+		return
+	}
+	if r.limiter != nil {
+		if err = r.limiter.wait(r.ctx, n); err != nil {
+			return 0, err
+		}
+	}
+	r.progress.Written += int64(n)
+	if r.progress.Total > 0 {
+		r.progress.Percent = float64(r.progress.Written) * 100 / float64(r.progress.Total)
+		if r.progress.Percent > 100 {
+			r.progress.Percent = 100
+		}
+	}
+	if r.callback != nil {
+		r.callback(r.progress)
+	}
+	if r.channel != nil {
+		// 不阻塞写入，通道已满时丢弃本次进度
+		select {
+		case r.channel <- r.progress:
+		default:
+		}
+	}
+	return
+}
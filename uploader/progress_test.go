@@ -0,0 +1,26 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	// 1字节/秒的速度需要等待1分钟
+	if err := limiter.wait(ctx, 60); err != context.DeadlineExceeded {
+		t.Fatal("应返回context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("ctx结束后没有停止等待")
+	}
+	// 被取消的配额应归还
+	if time.Until(limiter.next) > time.Second {
+		t.Fatal("配额未归还", time.Until(limiter.next))
+	}
+}
@@ -0,0 +1,373 @@
+package uploader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dxvgef/gommon/encrypt"
+)
+
+type (
+	// Resumable 可断点续传的分片上传
+	// 客户端先创建上传会话，再按顺序提交带偏移量的分片，断开后可查询会话的进度继续上传，
+	// 全部数据接收完成并校验通过后，使用Uploader的参数保存文件并返回与单次上传相同的Result
+	Resumable struct {
+		Uploader       *Uploader     // 保存文件时使用的上传实例，不会使用其Request
+		TempPath       string        // 存放上传会话和未完成数据的目录（绝对路径）
+		DirPermission  os.FileMode   // TempPath目录权限，如果目录已存在，则此参数无效
+		FilePermission os.FileMode   // 会话文件的权限
+		Expiration     time.Duration // 会话的有效期，0表示不过期
+
+		locks sync.Map
+	}
+	// UploadSession 上传会话
+	UploadSession struct {
+		ID        string `json:"id"`         // 会话ID
+		FileName  string `json:"file_name"`  // 客户端提交的原始文件名
+		MIME      string `json:"mime"`       // 客户端声明的MIME值
+		Size      int64  `json:"size"`       // 文件大小
+		Offset    int64  `json:"offset"`     // 已接收的字节数
+		Checksum  string `json:"checksum"`   // 文件的SHA-256值（hex），为空则在完成时不校验
+		CreatedAt int64  `json:"created_at"` // 创建时间（unix时间）
+	}
+)
+
+// Create 创建上传会话
+func (obj *Resumable) Create(fileName, mimeType string, size int64, checksum string) (session UploadSession, execErr Error) {
+	if size <= 0 {
+		err := errors.New("文件大小为0")
+		execErr = obj.Uploader.newError(ErrEmptyFile, 400, err)
+		return
+	}
+	// 按Uploader.FieldName的规则校验文件名和文件大小
+	if execErr = obj.Uploader.checkFile(obj.Uploader.rule(obj.Uploader.FieldName), fileName, size); execErr.Status != 0 {
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		execErr = obj.Uploader.newError(ErrSessionFailed, 500, err)
+		return
+	}
+	session = UploadSession{
+		ID:        hex.EncodeToString(id),
+		FileName:  fileName,
+		MIME:      mimeType,
+		Size:      size,
+		Checksum:  strings.ToLower(checksum),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if err := os.MkdirAll(obj.TempPath, obj.DirPermission); err != nil {
+		execErr = obj.Uploader.newError(ErrSessionFailed, 500, fmt.Errorf("创建目录失败 %s: %w", obj.TempPath, err))
+		return
+	}
+	partFile, err := os.OpenFile(obj.partPath(session.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, obj.FilePermission)
+	if err != nil {
+		execErr = obj.Uploader.newError(ErrSessionFailed, 500, err)
+		return
+	}
+	if err = partFile.Close(); err != nil {
+		execErr = obj.Uploader.newError(ErrSessionFailed, 500, err)
+		return
+	}
+	if err = obj.writeSession(&session); err != nil {
+		_ = os.Remove(obj.partPath(session.ID))
+		execErr = obj.Uploader.newError(ErrSessionFailed, 500, err)
+		return
+	}
+	return
+}
+
+// Session 获得上传会话，客户端断开后可根据其中的Offset继续上传
+func (obj *Resumable) Session(id string) (session UploadSession, execErr Error) {
+	session, execErr = obj.session(id)
+	if errors.Is(execErr, ErrSessionExpired) {
+		// 锁定后再删除，避免删除正在写入的会话
+		unlock := obj.lock(id)
+		obj.remove(id)
+		unlock()
+	}
+	return
+}
+
+// session 读取上传会话，不会删除已过期的会话
+func (obj *Resumable) session(id string) (session UploadSession, execErr Error) {
+	var err error
+	if !validSessionID(id) {
+		execErr = obj.Uploader.newError(ErrSessionNotFound, 404, errors.New("无效的会话ID "+id))
+		return
+	}
+	session, err = obj.readSession(id)
+	if err != nil {
+		execErr = obj.Uploader.newError(ErrSessionNotFound, 404, err)
+		if !os.IsNotExist(err) {
+			execErr.Status = 500
+		}
+		return
+	}
+	if obj.expired(&session) {
+		execErr = obj.Uploader.newError(ErrSessionExpired, 410, errors.New("上传会话已过期 "+id))
+		return
+	}
+	return
+}
+
+// WriteChunk 写入分片数据，offset必须等于会话中已接收的字节数
+// 复制数据的过程中出错（如客户端断开）时，已接收的部分数据会被保留，客户端可从新的Offset继续上传
+func (obj *Resumable) WriteChunk(id string, offset int64, r io.Reader) (session UploadSession, execErr Error) {
+	session, unlock, execErr := obj.lockSession(id)
+	if execErr.Status != 0 {
+		return
+	}
+	defer unlock()
+
+	if offset != session.Offset {
+		execErr = obj.Uploader.newError(ErrChunkOffset, 409, errors.New("分片的偏移量("+strconv.FormatInt(offset, 10)+")与已接收的字节数("+strconv.FormatInt(session.Offset, 10)+")不符"))
+		return
+	}
+
+	partFile, err := os.OpenFile(obj.partPath(id), os.O_WRONLY, obj.FilePermission)
+	if err != nil {
+		execErr = obj.Uploader.newError(ErrChunkFailed, 500, err)
+		return
+	}
+	defer func() {
+		if err = partFile.Close(); err != nil {
+		}
+	}()
+	if _, err = partFile.Seek(session.Offset, io.SeekStart); err != nil {
+		execErr = obj.Uploader.newError(ErrChunkFailed, 500, err)
+		return
+	}
+
+	// 写入的数据不能超出文件大小
+	limit := session.Size - session.Offset
+	reader := &sizeLimitReader{reader: r, limit: limit, err: errSizeExceeded}
+	// 按实际写入的字节数保存进度，写入失败时不能跳过未写入的数据
+	written, copyErr := io.Copy(partFile, reader)
+	if errors.Is(copyErr, errSizeExceeded) {
+		// 丢弃超出部分
+		if err = partFile.Truncate(session.Size); err != nil {
+			copyErr = err
+		}
+	}
+	if written > limit {
+		written = limit
+	}
+	if err = partFile.Sync(); err != nil {
+		// 无法确认数据已写入磁盘，丢弃本次写入的数据
+		if copyErr == nil {
+			copyErr = err
+		}
+		written = 0
+		_ = partFile.Truncate(session.Offset)
+	}
+
+	// 保存进度
+	session.Offset += written
+	if err = obj.writeSession(&session); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	switch {
+	case errors.Is(copyErr, errSizeExceeded):
+		execErr = obj.Uploader.newError(ErrChunkSizeExceeded, 413, errors.New("分片数据超出文件大小("+strconv.FormatInt(session.Size, 10)+")"))
+	case copyErr != nil:
+		execErr = obj.Uploader.newError(ErrChunkFailed, 500, copyErr)
+	}
+	return
+}
+
+// Finish 完成上传，校验数据完整性后使用Uploader的参数保存文件，成功后删除会话
+// checksum为空时使用创建会话时提交的值，两者都为空则不校验
+func (obj *Resumable) Finish(id string, checksum string) (result Result, execErr Error) {
+	return obj.FinishContext(context.Background(), id, checksum)
+}
+
+// FinishContext 完成上传，ctx结束或超过Uploader.WriteTimeout时中止保存文件并保留会话，客户端可以重新完成上传
+func (obj *Resumable) FinishContext(ctx context.Context, id string, checksum string) (result Result, execErr Error) {
+	session, unlock, execErr := obj.lockSession(id)
+	if execErr.Status != 0 {
+		return
+	}
+	defer unlock()
+
+	result.OriginalName = session.FileName
+	if session.Offset != session.Size {
+		execErr = obj.Uploader.newError(ErrIncomplete, 409, errors.New("已接收的字节数("+strconv.FormatInt(session.Offset, 10)+")与文件大小("+strconv.FormatInt(session.Size, 10)+")不符"))
+		return
+	}
+
+	partFile, err := os.Open(obj.partPath(id))
+	if err != nil {
+		execErr = obj.Uploader.newError(ErrReadFailed, 500, err)
+		return
+	}
+	defer func() {
+		if err = partFile.Close(); err != nil {
+		}
+	}()
+
+	// 校验SHA-256
+	if checksum == "" {
+		checksum = session.Checksum
+	}
+	if checksum != "" {
+		sum, err := encrypt.SHA256ByReader(partFile)
+		if err != nil {
+			execErr = obj.Uploader.newError(ErrReadFailed, 500, err)
+			return
+		}
+		if sum != strings.ToLower(checksum) {
+			obj.remove(id)
+			execErr = obj.Uploader.newError(ErrChecksumMismatch, 400, errors.New("文件的SHA-256值("+sum+")与提交的值("+checksum+")不符"))
+			return
+		}
+		if _, err = partFile.Seek(0, io.SeekStart); err != nil {
+			execErr = obj.Uploader.newError(ErrReadFailed, 500, err)
+			return
+		}
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", session.MIME)
+	result, execErr = obj.Uploader.save(ctx, source{
+		reader:    partFile,
+		fieldName: obj.Uploader.FieldName,
+		fileName:  session.FileName,
+		header:    header,
+		size:      session.Size,
+	}, obj.Uploader.SaveName)
+	if execErr.Status < 500 && execErr.Status != 499 && execErr.Status != 408 {
+		obj.remove(id)
+	}
+	return
+}
+
+// Abort 取消上传并删除会话
+func (obj *Resumable) Abort(id string) (execErr Error) {
+	if !validSessionID(id) {
+		execErr = obj.Uploader.newError(ErrSessionNotFound, 404, errors.New("无效的会话ID "+id))
+		return
+	}
+	unlock := obj.lock(id)
+	defer unlock()
+	obj.remove(id)
+	return
+}
+
+// CleanExpired 删除所有已过期的会话
+func (obj *Resumable) CleanExpired() error {
+	if obj.Expiration <= 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(obj.TempPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for k := range files {
+		id := strings.TrimSuffix(files[k].Name(), ".json")
+		if id == files[k].Name() || !validSessionID(id) {
+			continue
+		}
+		session, err := obj.readSession(id)
+		if err != nil || obj.expired(&session) {
+			unlock := obj.lock(id)
+			obj.remove(id)
+			unlock()
+		}
+	}
+	return nil
+}
+
+func (obj *Resumable) sessionPath(id string) string {
+	return filepath.Join(obj.TempPath, id+".json")
+}
+
+func (obj *Resumable) partPath(id string) string {
+	return filepath.Join(obj.TempPath, id+".part")
+}
+
+func (obj *Resumable) readSession(id string) (session UploadSession, err error) {
+	var data []byte
+	data, err = ioutil.ReadFile(obj.sessionPath(id))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &session)
+	return
+}
+
+// writeSession 保存会话，先写入临时文件再重命名，避免中断时损坏会话文件
+func (obj *Resumable) writeSession(session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	tempPath := obj.sessionPath(session.ID) + ".tmp"
+	if err = ioutil.WriteFile(tempPath, data, obj.FilePermission); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, obj.sessionPath(session.ID))
+}
+
+func (obj *Resumable) remove(id string) {
+	_ = os.Remove(obj.sessionPath(id))
+	_ = os.Remove(obj.partPath(id))
+	obj.locks.Delete(id)
+}
+
+func (obj *Resumable) expired(session *UploadSession) bool {
+	return obj.Expiration > 0 && time.Since(time.Unix(session.CreatedAt, 0)) > obj.Expiration
+}
+
+// lock 锁定会话，防止同一会话的分片被并发写入
+func (obj *Resumable) lock(id string) func() {
+	v, _ := obj.locks.LoadOrStore(id, &sync.Mutex{})
+	mutex := v.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// lockSession 确认会话存在后再锁定会话，避免为无效或不存在的会话ID创建锁
+func (obj *Resumable) lockSession(id string) (session UploadSession, unlock func(), execErr Error) {
+	if _, execErr = obj.Session(id); execErr.Status != 0 {
+		return
+	}
+	unlock = obj.lock(id)
+	// 等待锁的过程中会话可能已被删除或过期
+	if session, execErr = obj.session(id); execErr.Status != 0 {
+		if errors.Is(execErr, ErrSessionExpired) {
+			obj.remove(id)
+		}
+		unlock()
+		obj.locks.Delete(id)
+		unlock = nil
+	}
+	return
+}
+
+// validSessionID 检查会话ID是否为Create生成的格式，防止路径穿越
+func validSessionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,145 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const helloSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+func newResumable(root string) (*Resumable, *MemoryStorage) {
+	storage := &MemoryStorage{}
+	return &Resumable{
+		Uploader: &Uploader{
+			FieldName:   "file",
+			MaxSize:     1,
+			AllowMIME:   []string{"text/plain"},
+			SaveSubPath: "sub",
+			Storage:     storage,
+		},
+		TempPath:       root,
+		DirPermission:  0755,
+		FilePermission: 0644,
+	}, storage
+}
+
+func expectError(t *testing.T, execErr Error, code ErrorCode, status int) {
+	t.Helper()
+	if !errors.Is(execErr, code) || execErr.Status != status {
+		t.Fatalf("应返回%d(%d)，实际为%d(%d): %v", code, status, execErr.Code, execErr.Status, execErr)
+	}
+}
+
+func TestResumable(t *testing.T) {
+	root, err := ioutil.TempDir("", "resumable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	obj, storage := newResumable(root)
+
+	session, execErr := obj.Create("a.txt", "text/plain", 11, strings.ToUpper(helloSHA256))
+	if execErr.Status != 0 {
+		t.Fatal(execErr)
+	}
+
+	// 客户端断开时保留已写入的数据
+	session, execErr = obj.WriteChunk(session.ID, 0, &failingReader{data: "hello"})
+	expectError(t, execErr, ErrChunkFailed, 500)
+	if session, execErr = obj.Session(session.ID); execErr.Status != 0 || session.Offset != 5 {
+		t.Fatal("已接收的字节数应为5，实际为", session.Offset, execErr)
+	}
+
+	// 偏移量与已接收的字节数不符
+	_, execErr = obj.WriteChunk(session.ID, 0, strings.NewReader("hello"))
+	expectError(t, execErr, ErrChunkOffset, 409)
+	_, execErr = obj.Finish(session.ID, "")
+	expectError(t, execErr, ErrIncomplete, 409)
+
+	// 从新的偏移量继续上传
+	if session, execErr = obj.WriteChunk(session.ID, 5, strings.NewReader(" world")); execErr.Status != 0 || session.Offset != 11 {
+		t.Fatal("已接收的字节数应为11，实际为", session.Offset, execErr)
+	}
+
+	// 中止时保留会话，可以重新完成上传
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, execErr = obj.FinishContext(ctx, session.ID, "")
+	expectError(t, execErr, ErrCanceled, 499)
+	if names, _ := storage.List(""); len(names) > 0 {
+		t.Fatal("不应写入文件", names)
+	}
+
+	result, execErr := obj.Finish(session.ID, "")
+	if execErr.Status != 0 {
+		t.Fatal(execErr)
+	}
+	if result.OriginalName != "a.txt" || result.FileSize != 11 || result.FileMIME != "text/plain" || result.SHA256 != helloSHA256 {
+		t.Fatalf("上传结果不正确: %+v", result)
+	}
+	if data, ok := storage.Get("sub/" + result.FileName); !ok || string(data) != "hello world" {
+		t.Fatalf("文件写入不正确: %q", data)
+	}
+	// 完成后删除会话
+	_, execErr = obj.Session(session.ID)
+	expectError(t, execErr, ErrSessionNotFound, 404)
+	if names := dirNames(t, obj.TempPath); len(names) != 0 {
+		t.Fatal("不应留下会话文件", names)
+	}
+}
+
+func TestResumableErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "resumable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	obj, storage := newResumable(root)
+
+	_, execErr := obj.Create("a.txt", "text/plain", 2048, "")
+	expectError(t, execErr, ErrSizeExceeded, 413)
+	_, execErr = obj.Create("a.txt", "text/plain", 0, "")
+	expectError(t, execErr, ErrEmptyFile, 400)
+	_, execErr = obj.Session("../../etc/passwd")
+	expectError(t, execErr, ErrSessionNotFound, 404)
+
+	// 超出文件大小的数据被丢弃
+	session, execErr := obj.Create("a.txt", "text/plain", 11, "")
+	if execErr.Status != 0 {
+		t.Fatal(execErr)
+	}
+	session, execErr = obj.WriteChunk(session.ID, 0, strings.NewReader("hello world!!!"))
+	expectError(t, execErr, ErrChunkSizeExceeded, 413)
+	if session.Offset != 11 {
+		t.Fatal("已接收的字节数应为11，实际为", session.Offset)
+	}
+
+	// 校验失败时删除会话
+	_, execErr = obj.Finish(session.ID, strings.Repeat("0", 64))
+	expectError(t, execErr, ErrChecksumMismatch, 400)
+	_, execErr = obj.Session(session.ID)
+	expectError(t, execErr, ErrSessionNotFound, 404)
+	if names, _ := storage.List(""); len(names) > 0 {
+		t.Fatal("不应写入文件", names)
+	}
+
+	// 过期的会话
+	session, execErr = obj.Create("a.txt", "text/plain", 11, "")
+	if execErr.Status != 0 {
+		t.Fatal(execErr)
+	}
+	obj.Expiration = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	_, execErr = obj.WriteChunk(session.ID, 0, strings.NewReader("hello world"))
+	expectError(t, execErr, ErrSessionExpired, 410)
+	_, execErr = obj.Session(session.ID)
+	expectError(t, execErr, ErrSessionNotFound, 404)
+	if names := dirNames(t, obj.TempPath); len(names) != 0 {
+		t.Fatal("应删除过期的会话", names)
+	}
+}
@@ -0,0 +1,127 @@
+package uploader
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	errFileTooSmall        = errors.New("文件大小低于限制")
+	errRequestSizeExceeded = errors.New("请求大小超出限制")
+)
+
+type (
+	// Rule 上传控件的校验规则，文件名和大小在写入任何文件之前校验，MIME值在读取文件头部数据后校验
+	Rule struct {
+		AllowExt  []string // 允许的扩展名（不含.，不区分大小写），为空则不限制
+		DenyExt   []string // 禁止的扩展名（不含.，不区分大小写）
+		AllowMIME []string // 允许的MIME值，支持image/*形式的通配符，为空则使用Uploader.AllowMIME
+		MinSize   int64    // 文件大小下限（字节），0表示不限制
+		MaxSize   int64    // 文件大小上限（字节），0则使用Uploader.MaxSize
+		MaxCount  int      // 该控件的文件数量上限，0表示不限制
+	}
+	// limitedBody 限制大小的请求体
+	limitedBody struct {
+		*sizeLimitReader
+		io.Closer
+	}
+)
+
+// rule 获得上传控件的校验规则，未设置时返回零值
+func (obj *Uploader) rule(fieldName string) Rule {
+	return obj.Rules[fieldName]
+}
+
+// maxBytes 获得文件大小上限（字节）
+func (obj *Uploader) maxBytes(rule Rule) int64 {
+	if rule.MaxSize > 0 {
+		return rule.MaxSize
+	}
+	return obj.MaxSize * 1024
+}
+
+// checkFile 按文件名和文件大小校验，size为-1表示大小未知，此时在复制数据的过程中校验
+func (obj *Uploader) checkFile(rule Rule, fileName string, size int64) (execErr Error) {
+	ext := fileSuffix(fileName, "")
+	if inFold(rule.DenyExt, ext) || (len(rule.AllowExt) > 0 && !inFold(rule.AllowExt, ext)) {
+		execErr = obj.newError(ErrExtRejected, 400, errors.New("不允许上传扩展名为("+ext+")的文件"))
+		return
+	}
+	if size < 0 {
+		return
+	}
+	if size == 0 {
+		execErr = obj.newError(ErrEmptyFile, 400, errors.New("文件大小为0"))
+		return
+	}
+	if size < rule.MinSize {
+		execErr = obj.newError(ErrFileTooSmall, 400, errors.New("文件大小("+strconv.FormatInt(size, 10)+")低于限制("+strconv.FormatInt(rule.MinSize, 10)+")"))
+		return
+	}
+	if maxBytes := obj.maxBytes(rule); size > maxBytes {
+		execErr = obj.newError(ErrSizeExceeded, 413, errors.New("文件大小("+strconv.FormatInt(size, 10)+")超出限制("+strconv.FormatInt(maxBytes, 10)+")"))
+		return
+	}
+	return
+}
+
+// checkCount 校验上传控件的文件数量
+func (obj *Uploader) checkCount(fieldName string, count int) (execErr Error) {
+	if maxCount := obj.rule(fieldName).MaxCount; maxCount > 0 && count > maxCount {
+		execErr = obj.newError(ErrTooManyFiles, 400, errors.New(fieldName+"的文件数量("+strconv.Itoa(count)+")超出限制("+strconv.Itoa(maxCount)+")"))
+	}
+	return
+}
+
+// allowMIME 判断是否允许上传该MIME值的文件
+func (obj *Uploader) allowMIME(rule Rule, mimeType string) bool {
+	if len(rule.AllowMIME) > 0 {
+		return matchMIME(rule.AllowMIME, mimeType)
+	}
+	return matchMIME(obj.AllowMIME, mimeType)
+}
+
+// limitRequest 按MaxRequestSize限制请求体的大小，请求头中的长度已超出限制时直接返回错误
+func (obj *Uploader) limitRequest() (execErr Error) {
+	if obj.MaxRequestSize <= 0 {
+		return
+	}
+	if obj.Request.ContentLength > obj.MaxRequestSize {
+		execErr = obj.newError(ErrRequestSizeExceeded, 413, errors.New("请求大小("+strconv.FormatInt(obj.Request.ContentLength, 10)+")超出限制("+strconv.FormatInt(obj.MaxRequestSize, 10)+")"))
+		return
+	}
+	if _, ok := obj.Request.Body.(*limitedBody); ok || obj.Request.Body == nil {
+		return
+	}
+	obj.Request.Body = &limitedBody{
+		sizeLimitReader: &sizeLimitReader{reader: obj.Request.Body, limit: obj.MaxRequestSize, err: errRequestSizeExceeded},
+		Closer:          obj.Request.Body,
+	}
+	return
+}
+
+// matchMIME 判断MIME值是否匹配，支持image/*和*/*形式的通配符
+func matchMIME(patterns []string, mimeType string) bool {
+	for k := range patterns {
+		pattern := patterns[k]
+		if pattern == mimeType || pattern == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// inFold 检查string值在一个string slice中是否存在，不区分大小写
+func inFold(s []string, str string) bool {
+	for k := range s {
+		if strings.EqualFold(strings.TrimPrefix(s[k], "."), str) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package uploader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type (
+	// Scanner 病毒扫描器，在文件写入存储后端之前调用
+	Scanner interface {
+		// Scan 扫描数据，发现病毒时返回的ScanResult.Infected为true，无法完成扫描时返回错误
+		Scan(r io.Reader) (ScanResult, error)
+	}
+	// ScanResult 扫描结果
+	ScanResult struct {
+		Infected  bool   // 是否发现病毒
+		Signature string // 病毒名称
+	}
+	// InfectedError 发现病毒时Error.OriginalError的值，可使用errors.As获得
+	InfectedError struct {
+		Signature     string // 病毒名称
+		Quarantine    string // 文件在隔离存储中的名称，未隔离时为空
+		QuarantineErr error  // 写入隔离存储失败的错误
+	}
+)
+
+func (e *InfectedError) Error() string {
+	if e.Quarantine != "" {
+		return "文件包含病毒(" + e.Signature + ")，已隔离为 " + e.Quarantine
+	}
+	if e.QuarantineErr != nil {
+		return "文件包含病毒(" + e.Signature + ")，隔离失败: " + e.QuarantineErr.Error()
+	}
+	return "文件包含病毒(" + e.Signature + ")"
+}
+
+// scan 扫描临时文件，发现病毒时将文件写入Quarantine，扫描完成后文件重新定位到开头
+func (obj *Uploader) scan(file *os.File, result *Result) (execErr Error) {
+	scanResult, err := obj.Scanner.Scan(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		execErr = obj.newError(ErrScanFailed, 500, fmt.Errorf("病毒扫描失败: %w", err))
+		return
+	}
+	if !scanResult.Infected {
+		return
+	}
+
+	infectedErr := &InfectedError{Signature: scanResult.Signature}
+	if obj.Quarantine != nil {
+		// 隔离文件不使用原后缀名，避免被误执行
+		name := time.Now().Format("20060102150405") + "_" + result.SHA256
+		if err = obj.Quarantine.Put(name, file, PutOptions{Size: result.FileSize, MIME: result.FileMIME}); err != nil {
+			infectedErr.QuarantineErr = err
+		} else {
+			infectedErr.Quarantine = name
+		}
+	}
+	execErr = obj.newError(ErrInfected, 422, infectedErr)
+	return
+}
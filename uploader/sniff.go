@@ -0,0 +1,330 @@
+package uploader
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// 识别文件类型时读取的头部数据长度
+const sniffLen = 512
+
+const octetStream = "application/octet-stream"
+
+// MIME值的别名，统一转为标准值后再比较
+var mimeAliases = map[string]string{
+	"image/jpg":                    "image/jpeg",
+	"image/pjpeg":                  "image/jpeg",
+	"image/x-png":                  "image/png",
+	"image/x-ms-bmp":               "image/bmp",
+	"image/vnd.microsoft.icon":     "image/x-icon",
+	"image/heif":                   "image/heic",
+	"application/x-pdf":            "application/pdf",
+	"application/x-zip":            "application/zip",
+	"application/x-zip-compressed": "application/zip",
+	"application/x-gzip":           "application/gzip",
+	"application/x-rar":            "application/vnd.rar",
+	"application/x-rar-compressed": "application/vnd.rar",
+	"application/x-bzip":           "application/x-bzip2",
+	"application/x-compressed-tar": "application/gzip",
+	"video/avi":                    "video/x-msvideo",
+	"video/msvideo":                "video/x-msvideo",
+	"video/x-m4v":                  "video/mp4",
+	"audio/mp3":                    "audio/mpeg",
+	"audio/x-m4a":                  "audio/mp4",
+	"audio/wav":                    "audio/wave",
+	"audio/x-wav":                  "audio/wave",
+	"application/ogg":              "audio/ogg",
+	"application/x-msdos-program":  "application/x-msdownload",
+	"application/x-dosexec":        "application/x-msdownload",
+}
+
+// 可以通过文件头部识别出的MIME值及其对应的扩展名
+var mimeExtensions = map[string][]string{
+	"image/jpeg":                    {"jpg", "jpeg", "jpe", "jfif"},
+	"image/png":                     {"png"},
+	"image/gif":                     {"gif"},
+	"image/webp":                    {"webp"},
+	"image/bmp":                     {"bmp"},
+	"image/tiff":                    {"tif", "tiff"},
+	"image/x-icon":                  {"ico"},
+	"image/heic":                    {"heic", "heif"},
+	"application/pdf":               {"pdf"},
+	"application/zip":               {"zip"},
+	"application/x-ole-storage":     {},
+	"application/msword":            {"doc"},
+	"application/vnd.ms-excel":      {"xls"},
+	"application/vnd.ms-powerpoint": {"ppt"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {"docx"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {"xlsx"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {"pptx"},
+	"application/vnd.oasis.opendocument.text":                                   {"odt"},
+	"application/vnd.oasis.opendocument.spreadsheet":                            {"ods"},
+	"application/vnd.oasis.opendocument.presentation":                           {"odp"},
+	"application/epub+zip":        {"epub"},
+	"application/java-archive":    {"jar"},
+	"application/gzip":            {"gz", "tgz"},
+	"application/x-bzip2":         {"bz2"},
+	"application/x-xz":            {"xz"},
+	"application/x-7z-compressed": {"7z"},
+	"application/vnd.rar":         {"rar"},
+	"application/x-tar":           {"tar"},
+	"application/x-msdownload":    {"exe", "dll"},
+	"video/mp4":                   {"mp4", "m4v"},
+	"video/quicktime":             {"mov"},
+	"video/3gpp":                  {"3gp", "3g2"},
+	"video/webm":                  {"webm"},
+	"video/x-matroska":            {"mkv"},
+	"video/x-msvideo":             {"avi"},
+	"video/x-flv":                 {"flv"},
+	"video/mpeg":                  {"mpg", "mpeg"},
+	"audio/mpeg":                  {"mp3"},
+	"audio/mp4":                   {"m4a"},
+	"audio/ogg":                   {"ogg", "oga"},
+	"audio/wave":                  {"wav"},
+}
+
+// 文本和标记语言文件的扩展名对应的MIME值，这些格式无法通过头部数据区分，只能由扩展名确认
+// 浏览器会按扩展名将文件作为HTML、SVG或脚本解析，因此扩展名对应的类型必须与最终认定的MIME值一致
+var textExtensions = map[string]string{
+	"txt":      "text/plain",
+	"text":     "text/plain",
+	"log":      "text/plain",
+	"csv":      "text/csv",
+	"md":       "text/markdown",
+	"markdown": "text/markdown",
+	"css":      "text/css",
+	"html":     "text/html",
+	"htm":      "text/html",
+	"shtml":    "text/html",
+	"xhtml":    "application/xhtml+xml",
+	"xht":      "application/xhtml+xml",
+	"xml":      "application/xml",
+	"svg":      "image/svg+xml",
+	"js":       "application/javascript",
+	"mjs":      "application/javascript",
+	"json":     "application/json",
+}
+
+// 容器格式可以细化为的具体格式，例如docx文件在头部数据中可能只能识别为zip
+var containerMIME = map[string][]string{
+	"application/zip": {
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation",
+		"application/epub+zip",
+		"application/java-archive",
+	},
+	"application/x-ole-storage": {
+		"application/msword",
+		"application/vnd.ms-excel",
+		"application/vnd.ms-powerpoint",
+	},
+}
+
+// DetectMIME 根据文件头部数据（建议至少512字节）识别文件的MIME值，无法识别时返回application/octet-stream
+func DetectMIME(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1A\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "image/webp"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("AVI ")):
+		return "video/x-msvideo"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "audio/wave"
+	case bytes.HasPrefix(data, []byte("BM")) && len(data) >= 14 && data[6] == 0 && data[7] == 0 && data[8] == 0 && data[9] == 0:
+		return "image/bmp"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "image/tiff"
+	case bytes.HasPrefix(data, []byte("\x00\x00\x01\x00")):
+		return "image/x-icon"
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return "application/pdf"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return detectZip(data)
+	case bytes.HasPrefix(data, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")):
+		return "application/x-ole-storage"
+	case bytes.HasPrefix(data, []byte("\x1F\x8B")):
+		return "application/gzip"
+	case bytes.HasPrefix(data, []byte("BZh")):
+		return "application/x-bzip2"
+	case bytes.HasPrefix(data, []byte("\xFD7zXZ\x00")):
+		return "application/x-xz"
+	case bytes.HasPrefix(data, []byte("7z\xBC\xAF\x27\x1C")):
+		return "application/x-7z-compressed"
+	case bytes.HasPrefix(data, []byte("Rar!\x1A\x07")):
+		return "application/vnd.rar"
+	case len(data) >= 262 && bytes.Equal(data[257:262], []byte("ustar")):
+		return "application/x-tar"
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return "application/x-msdownload"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		return detectFtyp(data[8:12])
+	case bytes.HasPrefix(data, []byte("\x1A\x45\xDF\xA3")):
+		if bytes.Contains(data, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case bytes.HasPrefix(data, []byte("FLV\x01")):
+		return "video/x-flv"
+	case bytes.HasPrefix(data, []byte("\x00\x00\x01\xBA")), bytes.HasPrefix(data, []byte("\x00\x00\x01\xB3")):
+		return "video/mpeg"
+	case bytes.HasPrefix(data, []byte("ID3")),
+		len(data) >= 2 && data[0] == 0xFF && (data[1] == 0xFB || data[1] == 0xF3 || data[1] == 0xF2):
+		return "audio/mpeg"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	}
+	return normalizeMIME(http.DetectContentType(data))
+}
+
+// detectZip 根据zip中第一个文件的名称识别具体的文档格式
+func detectZip(data []byte) string {
+	// 本地文件头固定30字节，之后是文件名
+	if len(data) < 30 {
+		return "application/zip"
+	}
+	nameLen := int(data[26]) | int(data[27])<<8
+	extraLen := int(data[28]) | int(data[29])<<8
+	if 30+nameLen > len(data) {
+		return "application/zip"
+	}
+	name := string(data[30 : 30+nameLen])
+	switch {
+	case name == "mimetype":
+		// ODF和EPUB的第一个文件是未压缩的mimetype，内容即为MIME值
+		start := 30 + nameLen + extraLen
+		for t := range containerMIME["application/zip"] {
+			v := containerMIME["application/zip"][t]
+			if start <= len(data) && bytes.HasPrefix(data[start:], []byte(v)) {
+				return v
+			}
+		}
+	case strings.HasPrefix(name, "word/"):
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case strings.HasPrefix(name, "xl/"):
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case strings.HasPrefix(name, "ppt/"):
+		return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	case name == "META-INF/MANIFEST.MF", name == "META-INF/":
+		return "application/java-archive"
+	}
+	return "application/zip"
+}
+
+// detectFtyp 根据ISO媒体文件的品牌识别具体格式
+func detectFtyp(brand []byte) string {
+	switch string(brand) {
+	case "qt  ":
+		return "video/quicktime"
+	case "M4A ", "M4B ":
+		return "audio/mp4"
+	case "heic", "heix", "hevc", "heif", "mif1", "msf1":
+		return "image/heic"
+	case "3gp4", "3gp5", "3gp6", "3g2a":
+		return "video/3gpp"
+	}
+	return "video/mp4"
+}
+
+// normalizeMIME 去除MIME值中的参数并转为标准值
+func normalizeMIME(value string) string {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(value))
+	}
+	if v, ok := mimeAliases[mediaType]; ok {
+		return v
+	}
+	return mediaType
+}
+
+// compatibleMIME 检查声明的MIME值是否与识别出的MIME值一致
+func compatibleMIME(sniffed, declared string) bool {
+	if sniffed == declared {
+		return true
+	}
+	if inStr(containerMIME[sniffed], declared) {
+		return true
+	}
+	// 文本文件无法通过头部数据区分具体格式
+	switch sniffed {
+	case "text/plain":
+		return strings.HasPrefix(declared, "text/") || declared == "application/json" ||
+			declared == "application/javascript" || isXMLMIME(declared)
+	case "text/xml":
+		return isXMLMIME(declared)
+	}
+	return false
+}
+
+// isXMLMIME 判断是否为XML格式的MIME值
+func isXMLMIME(mimeType string) bool {
+	return mimeType == "text/xml" || mimeType == "application/xml" || strings.HasSuffix(mimeType, "+xml")
+}
+
+// extensionMIME 获得扩展名对应的MIME值，未知的扩展名返回空字符串
+func extensionMIME(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	for k, v := range mimeExtensions {
+		if inStr(v, ext) {
+			return k
+		}
+	}
+	return textExtensions[ext]
+}
+
+// verifyMIME 将识别出的MIME值与客户端声明的MIME值及文件扩展名进行比较
+// 返回最终认定的MIME值，ok为false表示文件内容与声明的类型或扩展名不符
+func verifyMIME(sniffed, declared, ext string) (result string, ok bool) {
+	result = sniffed
+	declared = normalizeMIME(declared)
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	extMIME := extensionMIME(ext)
+
+	// 比较客户端声明的MIME值，未声明或声明为octet-stream时视为未知
+	if declared != "" && declared != octetStream && declared != sniffed {
+		_, detectable := mimeExtensions[declared]
+		switch {
+		case inStr(containerMIME[sniffed], declared):
+			result = declared
+		case compatibleMIME(sniffed, declared):
+			// 文本文件的具体格式只由扩展名确认，声明的MIME值不能改变文件被解析的方式
+			if declared == extMIME {
+				result = declared
+			}
+		case sniffed == octetStream && !detectable:
+		default:
+			return
+		}
+	}
+
+	// 比较扩展名
+	if ext == "" {
+		ok = true
+		return
+	}
+	switch {
+	case extMIME == "":
+		// 未知的扩展名不能用于伪装可识别的文件类型
+		if _, detectable := mimeExtensions[result]; detectable {
+			return
+		}
+	case extMIME == result:
+	case result == sniffed && compatibleMIME(sniffed, extMIME):
+		result = extMIME
+	default:
+		return
+	}
+	ok = true
+	return
+}
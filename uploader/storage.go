@@ -0,0 +1,234 @@
+package uploader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Storage 文件存储后端，name均为相对于存储根的路径，使用/分隔
+	Storage interface {
+		// Put 写入文件，写入失败时不能留下不完整的文件
+		Put(name string, r io.Reader, opts PutOptions) error
+		// Delete 删除文件
+		Delete(name string) error
+		// Exists 判断文件是否存在
+		Exists(name string) (bool, error)
+		// URL 获得文件的访问地址
+		URL(name string) string
+	}
+	// PutOptions 写入文件时的参数
+	PutOptions struct {
+		Size        int64  // 文件大小，-1表示未知
+		MIME        string // 文件的MIME值
+		NoOverwrite bool   // 不覆盖已存在的文件，文件已存在时返回的错误满足errors.Is(err, os.ErrExist)
+	}
+	// LocalStorage 本地磁盘存储
+	LocalStorage struct {
+		RootPath       string      // 存储根路径（绝对路径）
+		DirPermission  os.FileMode // 文件存放目录权限，如果目录已存在，则此参数无效
+		FilePermission os.FileMode // 文件权限
+		BaseURL        string      // 访问文件的URL前缀，留空则URL返回空字符串
+	}
+)
+
+// OverwritePolicy 存储中已存在同名文件时的处理方式
+type OverwritePolicy uint8
+
+const (
+	OverwriteReplace OverwritePolicy = iota // 替换已存在的文件（默认）
+	OverwriteFail                           // 返回409错误
+	OverwriteRename                         // 在文件名后追加_序号
+)
+
+// 按OverwriteRename查找可用文件名时的最大尝试次数
+const maxRenameAttempts = 1000
+
+// storage 获得上传实例使用的存储后端，未指定时使用SaveRootPath的本地磁盘存储
+func (obj *Uploader) storage() Storage {
+	if obj.Storage != nil {
+		return obj.Storage
+	}
+	return &LocalStorage{
+		RootPath:       obj.SaveRootPath,
+		DirPermission:  obj.DirPermission,
+		FilePermission: obj.FilePermission,
+	}
+}
+
+// availableName 按OverwriteRename的规则查找存储中不存在的文件名，返回完整路径和存储文件名（不含后缀名）
+func (obj *Uploader) availableName(storage Storage, saveName, suffix string) (string, string, error) {
+	candidate := saveName
+	for i := 1; i <= maxRenameAttempts; i++ {
+		name, err := safeName(obj.SaveSubPath, candidate, suffix)
+		if err != nil {
+			return "", "", err
+		}
+		exists, err := storage.Exists(name)
+		if err != nil {
+			return "", "", err
+		}
+		if !exists {
+			return name, candidate, nil
+		}
+		candidate = saveName + "_" + strconv.Itoa(i)
+	}
+	return "", "", errors.New("无法找到可用的文件名 " + saveName)
+}
+
+// Path 获得文件在磁盘上的完整路径，结果始终位于RootPath之下
+func (s *LocalStorage) Path(name string) string {
+	return filepath.Join(s.RootPath, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// Put 写入文件
+func (s *LocalStorage) Put(name string, r io.Reader, opts PutOptions) (err error) {
+	filePath := s.Path(name)
+	dir := filepath.Dir(filePath)
+	// 递归创建目录
+	if err = os.MkdirAll(dir, s.DirPermission); err != nil {
+		return
+	}
+
+	// 先写入同目录下的临时文件，成功后再重命名，避免失败时留下不完整的文件或破坏已存在的文件
+	tempFile, err := s.createTemp(dir, "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return
+	}
+	tempPath := tempFile.Name()
+	defer func() {
+		if err != nil {
+			_ = tempFile.Close()
+			_ = os.Remove(tempPath)
+		}
+	}()
+	// 复制数据到文件
+	if _, err = io.Copy(tempFile, r); err != nil {
+		return
+	}
+	if err = tempFile.Sync(); err != nil {
+		return
+	}
+	if err = tempFile.Close(); err != nil {
+		return
+	}
+
+	if opts.NoOverwrite {
+		// 目标已存在时创建硬链接会失败，可以原子地完成判断和创建
+		if err = os.Link(tempPath, filePath); err != nil {
+			if os.IsExist(err) {
+				return
+			}
+			// 文件系统不支持硬链接时，退化为先判断再重命名
+			if _, statErr := os.Lstat(filePath); statErr == nil {
+				err = &os.PathError{Op: "put", Path: filePath, Err: os.ErrExist}
+				return
+			}
+			if err = os.Rename(tempPath, filePath); err != nil {
+				return
+			}
+		} else {
+			_ = os.Remove(tempPath)
+		}
+	} else if err = os.Rename(tempPath, filePath); err != nil {
+		return
+	}
+
+	// 同步目录，确保重命名已持久化
+	if dirFile, dirErr := os.Open(dir); dirErr == nil {
+		_ = dirFile.Sync()
+		_ = dirFile.Close()
+	}
+	return nil
+}
+
+// createTemp 在dir中创建临时文件，与直接创建文件一样使用FilePermission并受umask影响
+func (s *LocalStorage) createTemp(dir, prefix string) (*os.File, error) {
+	random := make([]byte, 8)
+	for i := 0; i < 100; i++ {
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(filepath.Join(dir, prefix+hex.EncodeToString(random)), os.O_RDWR|os.O_CREATE|os.O_EXCL, s.FilePermission)
+		if os.IsExist(err) {
+			continue
+		}
+		return file, err
+	}
+	return nil, errors.New("无法创建临时文件 " + dir)
+}
+
+// Delete 删除文件
+func (s *LocalStorage) Delete(name string) error {
+	err := os.Remove(s.Path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Exists 判断文件是否存在
+func (s *LocalStorage) Exists(name string) (bool, error) {
+	_, err := os.Stat(s.Path(name))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Open 打开文件
+func (s *LocalStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.Path(name))
+}
+
+// List 列出prefix目录（包括子目录）中的所有文件，忽略以.开头的文件（包括写入过程中的临时文件），目录不存在时返回空列表
+func (s *LocalStorage) List(prefix string) (names []string, err error) {
+	root := s.Path(prefix)
+	err = filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == root {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && filePath != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.RootPath, filePath)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return
+}
+
+// URL 获得文件的访问地址
+func (s *LocalStorage) URL(name string) string {
+	return joinURL(s.BaseURL, name)
+}
+
+// joinURL 拼接URL前缀和文件路径，前缀为空时返回空字符串
+func joinURL(baseURL, name string) string {
+	if baseURL == "" {
+		return ""
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(name, "/")
+}
@@ -0,0 +1,102 @@
+package uploader
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryFile MemoryStorage打开的文件，实现了io.Seeker
+type memoryFile struct {
+	*bytes.Reader
+}
+
+// Close 关闭文件
+func (memoryFile) Close() error {
+	return nil
+}
+
+// MemoryStorage 内存存储，适用于测试
+type MemoryStorage struct {
+	BaseURL string // 访问文件的URL前缀，留空则URL返回空字符串
+
+	mutex sync.RWMutex
+	files map[string][]byte
+}
+
+// Put 写入文件
+func (s *MemoryStorage) Put(name string, r io.Reader, opts PutOptions) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	name = path.Clean("/" + name)
+	if _, ok := s.files[name]; ok && opts.NoOverwrite {
+		return &os.PathError{Op: "put", Path: name, Err: os.ErrExist}
+	}
+	s.files[name] = data
+	return nil
+}
+
+// Delete 删除文件
+func (s *MemoryStorage) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.files, path.Clean("/"+name))
+	return nil
+}
+
+// Exists 判断文件是否存在
+func (s *MemoryStorage) Exists(name string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.files[path.Clean("/"+name)]
+	return ok, nil
+}
+
+// Open 打开文件
+func (s *MemoryStorage) Open(name string) (io.ReadCloser, error) {
+	data, ok := s.Get(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return memoryFile{bytes.NewReader(data)}, nil
+}
+
+// List 列出prefix目录（包括子目录）中的所有文件，按路径排序
+func (s *MemoryStorage) List(prefix string) ([]string, error) {
+	dir := strings.TrimRight(path.Clean("/"+prefix), "/") + "/"
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var names []string
+	for name := range s.files {
+		if strings.HasPrefix(name, dir) {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// URL 获得文件的访问地址
+func (s *MemoryStorage) URL(name string) string {
+	return joinURL(s.BaseURL, name)
+}
+
+// Get 获得文件的数据
+func (s *MemoryStorage) Get(name string) ([]byte, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data, ok := s.files[path.Clean("/"+name)]
+	return data, ok
+}
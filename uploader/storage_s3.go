@@ -0,0 +1,396 @@
+package uploader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Object Open打开的对象
+type s3Object struct {
+	storage *S3Storage
+	name    string
+	body    io.ReadCloser // 当前响应的数据，Seek之后为nil
+	offset  int64
+	size    int64
+}
+
+// S3Storage 兼容S3协议的对象存储（AWS S3、MinIO等），使用AWS Signature V4签名
+type S3Storage struct {
+	Endpoint  string       // 服务地址，例如https://s3.amazonaws.com或http://127.0.0.1:9000
+	Region    string       // 区域，留空则使用us-east-1
+	Bucket    string       // 存储桶名称
+	AccessKey string       // 访问密钥ID
+	SecretKey string       // 访问密钥
+	PathStyle bool         // 使用路径风格的地址（Endpoint/Bucket/Key），MinIO通常需要开启
+	BaseURL   string       // 访问文件的URL前缀，留空则使用对象的地址
+	Client    *http.Client // 留空则使用http.DefaultClient
+}
+
+// Put 写入文件
+func (s *S3Storage) Put(name string, r io.Reader, opts PutOptions) error {
+	// S3的PUT请求必须指定Content-Length，大小未知时先写入临时文件
+	if opts.Size < 0 {
+		tempFile, err := ioutil.TempFile("", "s3-upload-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tempFile.Close()
+			_ = os.Remove(tempFile.Name())
+		}()
+		if opts.Size, err = io.Copy(tempFile, r); err != nil {
+			return err
+		}
+		if _, err = tempFile.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tempFile
+	}
+
+	header := make(http.Header)
+	if opts.MIME != "" {
+		header.Set("Content-Type", opts.MIME)
+	}
+	if opts.NoOverwrite {
+		// 条件写入，对象已存在时返回412
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := s.do(http.MethodPut, name, "", ioutil.NopCloser(r), opts.Size, header)
+	if err != nil {
+		return err
+	}
+	if opts.NoOverwrite && resp.StatusCode == http.StatusPreconditionFailed {
+		_ = closeS3Response(resp, http.StatusPreconditionFailed)
+		return &os.PathError{Op: "put", Path: name, Err: os.ErrExist}
+	}
+	return closeS3Response(resp, http.StatusOK)
+}
+
+// Delete 删除文件
+func (s *S3Storage) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, name, "", nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	return closeS3Response(resp, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+// Exists 判断文件是否存在
+func (s *S3Storage) Exists(name string) (bool, error) {
+	resp, err := s.do(http.MethodHead, name, "", nil, 0, nil)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return false, closeS3Response(resp, http.StatusNotFound)
+	}
+	return true, closeS3Response(resp, http.StatusOK)
+}
+
+// Open 打开文件，返回的对象实现了io.Seeker，Seek之后使用Range请求读取后续的数据
+func (s *S3Storage) Open(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, name, "", nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = closeS3Response(resp, http.StatusNotFound)
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, closeS3Response(resp, http.StatusOK)
+	}
+	if resp.ContentLength < 0 {
+		return resp.Body, nil
+	}
+	return &s3Object{storage: s, name: name, body: resp.Body, size: resp.ContentLength}, nil
+}
+
+// List 列出prefix目录（包括子目录）中的所有文件，使用ListObjectsV2分页获取
+func (s *S3Storage) List(prefix string) ([]string, error) {
+	dir := s3Key(prefix)
+	if dir != "" {
+		dir += "/"
+	}
+	var (
+		names []string
+		token string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {dir}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", s3Query(query), nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, closeS3Response(resp, http.StatusOK)
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for k := range result.Contents {
+			names = append(names, result.Contents[k].Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Read 读取数据，Seek之后从新的位置发起Range请求
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.body == nil {
+		if o.offset >= o.size {
+			return 0, io.EOF
+		}
+		header := make(http.Header)
+		header.Set("Range", "bytes="+strconv.FormatInt(o.offset, 10)+"-")
+		resp, err := o.storage.do(http.MethodGet, o.name, "", nil, 0, header)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			return 0, closeS3Response(resp, http.StatusPartialContent)
+		}
+		o.body = resp.Body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek 设置下次读取的位置
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("无效的偏移量")
+	}
+	if offset != o.offset && o.body != nil {
+		_ = o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+// Close 关闭当前的响应
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// URL 获得文件的访问地址
+func (s *S3Storage) URL(name string) string {
+	if s.BaseURL != "" {
+		return joinURL(s.BaseURL, s3Key(name))
+	}
+	objectURL, err := s.objectURL(name)
+	if err != nil {
+		return ""
+	}
+	return objectURL.String()
+}
+
+// s3Key 将文件路径转为对象的key
+func s3Key(name string) string {
+	return strings.TrimLeft(path.Clean("/"+name), "/")
+}
+
+// objectURL 获得对象的请求地址
+func (s *S3Storage) objectURL(name string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New("无效的S3服务地址 " + s.Endpoint)
+	}
+	host := endpoint.Host
+	escapedPath := "/" + s3EscapePath(s3Key(name))
+	if s.PathStyle {
+		escapedPath = "/" + s3Escape(s.Bucket) + escapedPath
+	} else {
+		host = s.Bucket + "." + host
+	}
+	return url.Parse(endpoint.Scheme + "://" + host + escapedPath)
+}
+
+// do 发送签名后的请求，query必须是s3Query编码后的参数
+func (s *S3Storage) do(method, name, query string, body io.ReadCloser, size int64, header http.Header) (*http.Response, error) {
+	objectURL, err := s.objectURL(name)
+	if err != nil {
+		return nil, err
+	}
+	objectURL.RawQuery = query
+	req, err := http.NewRequest(method, objectURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for k := range header {
+		req.Header[k] = header[k]
+	}
+	s.sign(req, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// sign 使用AWS Signature V4对请求签名，请求体不参与签名
+func (s *S3Storage) sign(req *http.Request, t time.Time) {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	scope := t.Format("20060102") + "/" + region + "/s3/aws4_request"
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", "UNSIGNED-PAYLOAD")
+
+	// 规范请求
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": "UNSIGNED-PAYLOAD",
+		"x-amz-date":           amzDate,
+	}
+	headerNames := make([]string, 0, len(headers))
+	for k := range headers {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for k := range headerNames {
+		canonicalHeaders.WriteString(headerNames[k] + ":" + headers[headerNames[k]] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	// 待签名字符串
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	// 派生签名密钥
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath 按S3的规则编码对象路径，保留/
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for k := range segments {
+		segments[k] = s3Escape(segments[k])
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Escape 按S3的规则编码字符串，仅保留A-Z、a-z、0-9、-、_、.、~
+func s3Escape(s string) string {
+	const hexChars = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexChars[c>>4])
+		b.WriteByte(hexChars[c&15])
+	}
+	return b.String()
+}
+
+// s3Query 按签名的规则编码请求参数，参数名排序后使用s3Escape编码
+func s3Query(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range values[k] {
+			pairs = append(pairs, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// closeS3Response 关闭响应，状态码不在expected中时返回错误
+func closeS3Response(resp *http.Response, expected ...int) error {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	for k := range expected {
+		if resp.StatusCode == expected[k] {
+			return nil
+		}
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.New("S3请求失败 " + resp.Status + " " + string(body))
+}
@@ -0,0 +1,122 @@
+package uploader
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// s3Stub 模拟兼容S3协议的服务端，仅支持路径风格的PUT/HEAD/GET/DELETE
+type s3Stub struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (stub *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AK/") || r.Header.Get("x-amz-date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stub.objects[key] = data
+		stub.types[key] = r.Header.Get("Content-Type")
+	case http.MethodHead, http.MethodGet:
+		data, ok := stub.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// 支持Range请求
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(stub.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	stub := &s3Stub{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	storage := &S3Storage{
+		Endpoint:  server.URL,
+		Bucket:    "bucket",
+		AccessKey: "AK",
+		SecretKey: "SK",
+		PathStyle: true,
+	}
+
+	// 已知大小和未知大小
+	if err := storage.Put("a/b c.txt", strings.NewReader("hello"), PutOptions{Size: 5, MIME: "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put("/a/d.txt", strings.NewReader("world"), PutOptions{Size: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if string(stub.objects["/bucket/a/b c.txt"]) != "hello" || stub.types["/bucket/a/b c.txt"] != "text/plain" {
+		t.Fatal("对象写入不正确", stub.objects)
+	}
+	if string(stub.objects["/bucket/a/d.txt"]) != "world" {
+		t.Fatal("未知大小的对象写入不正确", stub.objects)
+	}
+
+	// Seek之后使用Range请求读取
+	file, err := storage.Open("a/d.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.(io.Seeker).Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(file)
+	_ = file.Close()
+	if err != nil || string(data) != "rld" {
+		t.Fatal("Range读取不正确", string(data), err)
+	}
+
+	exists, err := storage.Exists("a/b c.txt")
+	if err != nil || !exists {
+		t.Fatal("对象应存在", err)
+	}
+	if err = storage.Delete("a/b c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	exists, err = storage.Exists("a/b c.txt")
+	if err != nil || exists {
+		t.Fatal("对象应已删除", err)
+	}
+
+	if u := storage.URL("a/b c.txt"); u != server.URL+"/bucket/a/b%20c.txt" {
+		t.Fatal("URL不正确", u)
+	}
+
+	// 签名错误时返回错误
+	storage.AccessKey = "other"
+	if err = storage.Put("x.txt", strings.NewReader("x"), PutOptions{Size: 1}); err == nil {
+		t.Fatal("应返回错误")
+	}
+}
@@ -0,0 +1,165 @@
+package uploader
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+// failingReader 读取部分数据后返回错误
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("读取失败")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// dirNames 获得目录中的所有文件名（包括以.开头的临时文件）
+func dirNames(t *testing.T, dir string) (names []string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range files {
+		names = append(names, files[k].Name())
+	}
+	return
+}
+
+func TestLocalStoragePut(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	storage := &LocalStorage{RootPath: root, DirPermission: 0755, FilePermission: 0666}
+
+	if err = storage.Put("sub/a.txt", strings.NewReader("old"), PutOptions{Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	check := func(content string) {
+		t.Helper()
+		data, err := ioutil.ReadFile(storage.Path("sub/a.txt"))
+		if err != nil || string(data) != content {
+			t.Fatalf("文件内容应为%q，实际为%q: %v", content, data, err)
+		}
+		if names := dirNames(t, filepath.Join(root, "sub")); len(names) != 1 {
+			t.Fatal("不应留下临时文件", names)
+		}
+	}
+	check("old")
+
+	// 文件权限与直接创建文件一样受umask影响
+	expected, err := os.OpenFile(filepath.Join(root, "expected"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = expected.Close()
+	expectedInfo, err := os.Stat(expected.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(storage.Path("sub/a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != expectedInfo.Mode().Perm() {
+		t.Fatal("文件权限应为", expectedInfo.Mode().Perm(), "实际为", info.Mode().Perm())
+	}
+
+	// 复制失败时保留已存在的文件
+	if err = storage.Put("sub/a.txt", &failingReader{data: "new content"}, PutOptions{Size: -1}); err == nil {
+		t.Fatal("读取失败时应返回错误")
+	}
+	check("old")
+
+	// 不覆盖已存在的文件
+	if err = storage.Put("sub/a.txt", strings.NewReader("new"), PutOptions{Size: 3, NoOverwrite: true}); !errors.Is(err, os.ErrExist) {
+		t.Fatal("应返回os.ErrExist", err)
+	}
+	check("old")
+
+	if err = storage.Put("sub/a.txt", strings.NewReader("new"), PutOptions{Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	check("new")
+
+	// 路径不能超出RootPath
+	if err = storage.Put("../../b.txt", strings.NewReader("b"), PutOptions{Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "b.txt")); err != nil {
+		t.Fatal("文件应写入RootPath之下", err)
+	}
+}
+
+func TestLocalStorageOverwrite(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	upload := func(policy OverwritePolicy, content string) (Result, Error) {
+		obj := Uploader{
+			FieldName:      "file",
+			MaxSize:        1,
+			AllowMIME:      []string{"text/plain"},
+			SaveRootPath:   root,
+			SaveSubPath:    "sub",
+			SaveName:       "a",
+			DirPermission:  0755,
+			FilePermission: 0644,
+			Overwrite:      policy,
+			Request:        uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", content)),
+		}
+		return obj.Exec()
+	}
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(root, "sub", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	for k, expected := range []string{"a.txt", "a_1.txt", "a_2.txt"} {
+		content := strings.Repeat("x", k+1)
+		result, execErr := upload(OverwriteRename, content)
+		if execErr.Status != 0 {
+			t.Fatal(execErr)
+		}
+		if result.FileName != expected || read(expected) != content {
+			t.Fatal("文件名应为", expected, "实际为", result.FileName)
+		}
+	}
+
+	_, execErr := upload(OverwriteFail, "new")
+	if !errors.Is(execErr, ErrFileExists) || execErr.Status != 409 {
+		t.Fatalf("应返回%d(409)，实际为%d(%d): %v", ErrFileExists, execErr.Code, execErr.Status, execErr)
+	}
+	if read("a.txt") != "x" {
+		t.Fatal("已存在的文件不应被覆盖")
+	}
+
+	if _, execErr = upload(OverwriteReplace, "new"); execErr.Status != 0 {
+		t.Fatal(execErr)
+	}
+	if read("a.txt") != "new" {
+		t.Fatal("已存在的文件应被替换")
+	}
+	if names := dirNames(t, filepath.Join(root, "sub")); len(names) != 3 {
+		t.Fatal("不应留下临时文件", names)
+	}
+}
@@ -0,0 +1,189 @@
+package uploader
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/dxvgef/gommon/encrypt"
+)
+
+var (
+	errSizeExceeded      = errors.New("文件大小超出限制")
+	errTotalSizeExceeded = errors.New("文件总大小超出限制")
+)
+
+// sizeLimitReader 读取的数据超过limit时返回err
+type sizeLimitReader struct {
+	reader io.Reader
+	limit  int64
+	min    int64 // 读取完毕时的最小字节数，不足时返回errFileTooSmall
+	n      int64 // 已读取的字节数
+	err    error
+}
+
+func (r *sizeLimitReader) Read(p []byte) (n int, err error) {
+	if r.n > r.limit {
+		return 0, r.err
+	}
+	// 最多多读一个字节，用于判断是否超出限制
+	if remain := r.limit - r.n + 1; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err = r.reader.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		return n, r.err
+	}
+	if err == io.EOF && r.n < r.min {
+		return n, errFileTooSmall
+	}
+	return n, err
+}
+
+// spool 将数据写入临时文件并计算SHA-256，返回的文件已定位到开头，使用完毕后需调用closeSpool
+func (obj *Uploader) spool(r io.Reader) (*os.File, string, error) {
+	tempFile, err := obj.tempFile()
+	if err != nil {
+		return nil, "", err
+	}
+	h := encrypt.NewSHA256()
+	if _, err = io.Copy(io.MultiWriter(tempFile, h), r); err == nil {
+		_, err = tempFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		closeSpool(tempFile)
+		return nil, "", err
+	}
+	return tempFile, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tempFile 在TempPath中创建临时文件
+func (obj *Uploader) tempFile() (*os.File, error) {
+	return ioutil.TempFile(obj.TempPath, "upload-")
+}
+
+// closeSpool 关闭并删除临时文件
+func closeSpool(tempFile *os.File) {
+	_ = tempFile.Close()
+	_ = os.Remove(tempFile.Name())
+}
+
+// contextReader 在ctx结束后读取数据时返回ctx.Err()
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// copyError 将复制数据时超出大小限制或上传被中止的错误转为Error，其它错误返回零值，maxBytes为文件大小上限
+func (obj *Uploader) copyError(err error, maxBytes int64) (execErr Error) {
+	switch {
+	case errors.Is(err, errSizeExceeded):
+		execErr = obj.newError(ErrSizeExceeded, 413, errors.New("文件大小超出限制("+strconv.FormatInt(maxBytes, 10)+")"))
+	case errors.Is(err, errFileTooSmall):
+		execErr = obj.newError(ErrFileTooSmall, 400, err)
+	case errors.Is(err, errRequestSizeExceeded):
+		execErr = obj.newError(ErrRequestSizeExceeded, 413, errors.New("请求大小超出限制("+strconv.FormatInt(obj.MaxRequestSize, 10)+")"))
+	case errors.Is(err, errTotalSizeExceeded):
+		execErr = obj.newError(ErrTotalSizeExceeded, 413, err)
+	case errors.Is(err, context.Canceled):
+		execErr = obj.newError(ErrCanceled, 499, context.Canceled)
+	case errors.Is(err, context.DeadlineExceeded):
+		execErr = obj.newError(ErrTimeout, 408, context.DeadlineExceeded)
+	}
+	return
+}
+
+// ExecStream 以流的方式执行上传，依次处理fieldNames（留空则使用FieldName）下的所有文件
+// 与ExecAll不同，此方法不会预先将整个表单读入内存或临时文件，而是在读取请求体的同时直接写入存储后端，
+// 并在复制数据的过程中判断MaxSize和MaxTotalSize，超出限制时立即中止并返回413错误，
+// 客户端断开连接或超过WriteTimeout时同样立即中止，Rules中的MaxCount在读取到超出数量的文件时才能判断，之前的文件已被保存
+// results和fileErrs按文件在请求体中的顺序一一对应，fileErrs[i].Status为0表示该文件上传成功
+// execErr表示整体性的错误，此时之前已成功保存的文件仍会保留在results中
+func (obj *Uploader) ExecStream(fieldNames ...string) (results []Result, fileErrs []Error, execErr Error) {
+	if len(fieldNames) == 0 {
+		fieldNames = []string{obj.FieldName}
+	}
+
+	if execErr = obj.limitRequest(); execErr.Status != 0 {
+		return
+	}
+	multipartReader, err := obj.Request.MultipartReader()
+	if err != nil {
+		execErr = obj.newError(ErrNoFile, 400, err)
+		return
+	}
+
+	counts := make(map[string]int)
+	var total *sizeLimitReader
+	if obj.MaxTotalSize > 0 {
+		total = &sizeLimitReader{limit: obj.MaxTotalSize * 1024, err: errTotalSizeExceeded}
+	}
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if execErr = obj.copyError(err, 0); execErr.Status == 0 {
+				execErr = obj.newError(ErrNoFile, 400, err)
+			}
+			return
+		}
+		// 跳过普通表单字段和未指定的文件字段
+		if part.FileName() == "" || !inStr(fieldNames, part.FormName()) {
+			continue
+		}
+
+		// 文件数量超出限制时中止，文件名不符合规则时跳过该文件
+		counts[part.FormName()]++
+		if execErr = obj.checkCount(part.FormName(), counts[part.FormName()]); execErr.Status != 0 {
+			return
+		}
+		if fileErr := obj.checkFile(obj.rule(part.FormName()), part.FileName(), -1); fileErr.Status != 0 {
+			results = append(results, Result{FieldName: part.FormName(), OriginalName: part.FileName()})
+			fileErrs = append(fileErrs, fileErr)
+			continue
+		}
+
+		src := source{
+			reader:    part,
+			fieldName: part.FormName(),
+			fileName:  part.FileName(),
+			header:    part.Header,
+			size:      -1,
+		}
+		if total != nil {
+			total.reader = part
+			src.reader = total
+		}
+		saveName := obj.SaveName
+		if saveName != "" && len(results) > 0 {
+			saveName += "_" + strconv.Itoa(len(results))
+		}
+		result, fileErr := obj.save(obj.Request.Context(), src, saveName)
+		result.FieldName = part.FormName()
+		if fileErr.Status == 413 || fileErr.Status == 499 || fileErr.Status == 408 {
+			execErr = fileErr
+			return
+		}
+		results = append(results, result)
+		fileErrs = append(fileErrs, fileErr)
+	}
+
+	if len(results) == 0 {
+		execErr = obj.newError(ErrNoFile, 400, errors.New("请求中没有要上传的文件"))
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package uploader
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+func TestExecStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *http.Request
+		prepare func(obj *Uploader)
+		code    ErrorCode // 0表示应上传成功
+		status  int
+		saved   []string // 应保存的文件
+	}{
+		{
+			name: "多个文件",
+			request: uploadertest.NewRequest("/",
+				uploadertest.Sized("file", "a.txt", 600, 'a'),
+				uploadertest.Sized("file", "b.txt", 600, 'b'),
+			),
+			saved: []string{"a.txt", "b.txt"},
+		},
+		{
+			name: "第2个文件过大",
+			request: uploadertest.NewRequest("/",
+				uploadertest.Sized("file", "a.txt", 600, 'a'),
+				uploadertest.Sized("file", "b.txt", 2048, 'b'),
+			),
+			code:   ErrSizeExceeded,
+			status: 413,
+			saved:  []string{"a.txt"},
+		},
+		{
+			name: "总大小超出限制",
+			request: uploadertest.NewRequest("/",
+				uploadertest.Sized("file", "a.txt", 600, 'a'),
+				uploadertest.Sized("file", "b.txt", 600, 'b'),
+			),
+			prepare: func(obj *Uploader) {
+				obj.MaxTotalSize = 1
+			},
+			code:   ErrTotalSizeExceeded,
+			status: 413,
+			saved:  []string{"a.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &MemoryStorage{}
+			obj := Uploader{
+				FieldName: "file",
+				MaxSize:   1,
+				AllowMIME: []string{"text/plain"},
+				Storage:   storage,
+				Request:   tt.request,
+			}
+			if tt.prepare != nil {
+				tt.prepare(&obj)
+			}
+			results, fileErrs, execErr := obj.ExecStream()
+			if tt.code == 0 {
+				if execErr.Status != 0 {
+					t.Fatal(execErr)
+				}
+			} else if !errors.Is(execErr, tt.code) || execErr.Status != tt.status {
+				t.Fatalf("应返回%d(%d)，实际为%d(%d): %v", tt.code, tt.status, execErr.Code, execErr.Status, execErr)
+			}
+			if len(results) != len(tt.saved) || len(fileErrs) != len(tt.saved) {
+				t.Fatalf("上传结果不正确: %+v", results)
+			}
+			if names, _ := storage.List(""); len(names) != len(tt.saved) {
+				t.Fatal("只应保存", tt.saved, "实际为", names)
+			}
+			for k, name := range tt.saved {
+				if fileErrs[k].Status != 0 || results[k].FileName != name {
+					t.Fatalf("上传结果不正确: %+v %v", results[k], fileErrs[k])
+				}
+				data, ok := storage.Get(name)
+				if !ok || !bytes.Equal(data, bytes.Repeat([]byte{name[0]}, 600)) {
+					t.Fatal("文件写入不正确", name)
+				}
+			}
+		})
+	}
+}
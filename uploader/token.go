@@ -0,0 +1,166 @@
+package uploader
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dxvgef/gommon/encrypt"
+)
+
+// 请求中携带上传令牌的参数名和头信息
+const (
+	TokenParam  = "token"
+	TokenHeader = "X-Upload-Token"
+)
+
+var (
+	errInvalidToken = errors.New("上传令牌无效")
+	errTokenExpired = errors.New("上传令牌已过期")
+)
+
+// UploadToken 预签名上传令牌中的上传参数，Handler校验令牌后使用这些参数代替模板中的对应参数
+type UploadToken struct {
+	FieldName string   `json:"field,omitempty"`     // 上传控件的name值，为空则使用模板的FieldName
+	MaxSize   int64    `json:"max_size,omitempty"`  // 文件大小上限（字节），0则使用模板的限制
+	MaxCount  int      `json:"max_count,omitempty"` // 文件数量上限，0则使用模板的限制
+	AllowMIME []string `json:"mime,omitempty"`      // 允许的MIME值，支持image/*形式的通配符，为空则使用模板的限制
+	SubPath   string   `json:"path,omitempty"`      // 存储子路径，为空则使用模板的SaveSubPath
+	SaveName  string   `json:"name,omitempty"`      // 存储文件名（不含后缀名），为空则使用模板的SaveName
+	ExpiresAt int64    `json:"exp"`                 // 过期时间（unix时间）
+}
+
+// SignUploadToken 使用HMAC-SHA256签发上传令牌，令牌在ttl之后过期
+// 令牌格式为base64url(JSON).hex(HMAC)，可放在URL参数或头信息中
+func SignUploadToken(token UploadToken, secret []byte, ttl time.Duration) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("secret不能为空")
+	}
+	token.ExpiresAt = time.Now().Add(ttl).Unix()
+	data, err := json.Marshal(&token)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	sign, err := encrypt.SHA256ByBytes([]byte(payload), secret)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + sign, nil
+}
+
+// ParseUploadToken 校验令牌的签名和有效期并解析上传参数
+func ParseUploadToken(s string, secret []byte) (token UploadToken, err error) {
+	if len(secret) == 0 {
+		err = errors.New("secret不能为空")
+		return
+	}
+	pos := strings.LastIndexByte(s, '.')
+	if pos < 0 {
+		err = errInvalidToken
+		return
+	}
+	payload, sign := s[:pos], s[pos+1:]
+	expected, err := encrypt.SHA256ByBytes([]byte(payload), secret)
+	if err != nil {
+		return
+	}
+	if !hmac.Equal([]byte(sign), []byte(expected)) {
+		err = errInvalidToken
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		err = errInvalidToken
+		return
+	}
+	if err = json.Unmarshal(data, &token); err != nil {
+		err = errInvalidToken
+		return
+	}
+	if time.Now().Unix() > token.ExpiresAt {
+		err = errTokenExpired
+		return
+	}
+	return
+}
+
+// PresignURL 签发上传令牌并附加到上传地址的参数中
+func PresignURL(uploadURL string, token UploadToken, secret []byte, ttl time.Duration) (string, error) {
+	u, err := url.Parse(uploadURL)
+	if err != nil {
+		return "", err
+	}
+	signed, err := SignUploadToken(token, secret, ttl)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(TokenParam, signed)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// requestToken 获得请求中的上传令牌，优先使用头信息
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get(TokenHeader); token != "" {
+		return token
+	}
+	return r.URL.Query().Get(TokenParam)
+}
+
+// verifyToken 校验请求中的上传令牌
+func (obj *Uploader) verifyToken(r *http.Request, secret []byte) (token UploadToken, execErr Error) {
+	s := requestToken(r)
+	if s == "" {
+		execErr = obj.newError(ErrInvalidToken, 403, errors.New("请求中没有上传令牌"))
+		return
+	}
+	token, err := ParseUploadToken(s, secret)
+	if err == errTokenExpired {
+		execErr = obj.newError(ErrTokenExpired, 403, err)
+		return
+	}
+	if err != nil {
+		execErr = obj.newError(ErrInvalidToken, 403, err)
+	}
+	return
+}
+
+// applyToken 使用令牌中的上传参数代替模板中的对应参数，令牌中的限制应用到FieldName和fieldNames中的所有上传控件
+func (obj *Uploader) applyToken(token UploadToken, fieldNames []string) {
+	if token.FieldName != "" {
+		obj.FieldName = token.FieldName
+	}
+	if token.SubPath != "" {
+		obj.SaveSubPath = token.SubPath
+	}
+	if token.SaveName != "" {
+		obj.SaveName = token.SaveName
+	}
+
+	// 复制规则，避免修改模板中的map
+	rules := make(map[string]Rule, len(obj.Rules)+len(fieldNames)+1)
+	for k, v := range obj.Rules {
+		rules[k] = v
+	}
+	for _, fieldName := range append([]string{obj.FieldName}, fieldNames...) {
+		rule := rules[fieldName]
+		if token.MaxSize > 0 {
+			rule.MaxSize = token.MaxSize
+		}
+		if token.MaxCount > 0 {
+			rule.MaxCount = token.MaxCount
+		}
+		if len(token.AllowMIME) > 0 {
+			rule.AllowMIME = token.AllowMIME
+		}
+		rules[fieldName] = rule
+	}
+	obj.Rules = rules
+}
@@ -1,41 +1,83 @@
 package uploader
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
+
+	"github.com/dxvgef/gommon/encrypt"
 )
 
+// 解析multipart表单时使用的内存上限，与http.Request.FormFile的默认值保持一致
+const defaultMaxMemory = 32 << 20
+
 type (
 	// Uploader 上传实例及参数
 	Uploader struct {
-		DirPermission  os.FileMode // 文件存放目录权限，如果目录已存在，则此参数无效
-		FilePermission os.FileMode // 文件权限
-		MaxSize        int64       // 文件大小限制（KB）
-		FieldName      string      // 上传控件的name值
-		SaveName       string      // 存储文件名（不含后缀名），留空则保存原文件名
-		SaveRootPath   string      // 存储根路径（绝对路径）
-		SaveSubPath    string      // 存储子路径（相对SaveRootPath）
-		SaveSuffix     string      // 存储文件的后缀名（如果指定了此属性值，则强制更换后缀名）
-		AllowMIME      []string    // 允许上传的文件MIME值
+		DirPermission  os.FileMode     // 文件存放目录权限，如果目录已存在，则此参数无效
+		FilePermission os.FileMode     // 文件权限
+		MaxSize        int64           // 文件大小限制（KB）
+		MaxTotalSize   int64           // 多文件上传时所有文件的总大小限制（KB），0表示不限制
+		MaxRequestSize int64           // 请求体的大小限制（字节），0表示不限制
+		Rules          map[string]Rule // 按上传控件name值设置的校验规则，优先于MaxSize和AllowMIME
+		FieldName      string          // 上传控件的name值
+		SaveName       string          // 存储文件名（不含后缀名），留空则按NameStrategy生成。多文件上传时从第二个文件起追加_序号
+		NameStrategy   NameStrategy    // 存储文件名的生成策略，仅在SaveName为空时生效
+		NameFunc       NameFunc        // NameStrategy为NameCustom时使用的命名函数
+		HashShard      int             // NameStrategy为NameHash时的目录分级数，每级2个字符，例如2表示ab/cd/abcdef...
+		Deduplicate    bool            // NameStrategy为NameHash时，如果存储中已存在相同内容的文件则跳过写入
+		SaveRootPath   string          // 存储根路径（绝对路径）
+		SaveSubPath    string          // 存储子路径（相对SaveRootPath）
+		SaveSuffix     string          // 存储文件的后缀名（如果指定了此属性值，则强制更换后缀名）
+		TempPath       string          // 临时文件目录，留空则使用系统临时目录
+		AllowMIME      []string        // 允许上传的文件MIME值（按文件内容识别，不信任客户端提交的Content-Type）
+		Image          *ImageOptions   // 图片处理参数，为nil则不处理
+		Extract        *ExtractOptions // 压缩包解压参数，为nil则不解压
+		Storage        Storage         // 存储后端，留空则使用SaveRootPath的本地磁盘存储
+		Overwrite      OverwritePolicy // 存储中已存在同名文件时的处理方式
+		Scanner        Scanner         // 病毒扫描器，为nil则不扫描
+		Quarantine     Storage         // 存放包含病毒的文件的存储后端，为nil则直接丢弃
+		RateLimiter    *RateLimiter    // 写入存储后端时的限速器，可在多个上传实例之间共享，为nil则不限速
+		OnProgress     func(Progress)  // 写入存储后端时的进度回调，在写入数据的goroutine中同步调用
+		ProgressChan   chan<- Progress // 写入存储后端时的进度通道，通道已满时丢弃本次进度，不会关闭通道
+		WriteTimeout   time.Duration   // 单个文件从读取到写入存储后端的超时时间，0表示不限制
+		WriteMetadata  bool            // 在文件旁写入JSON格式的元数据文件（文件名.meta.json），可使用ListUploads、ReadMetadata和DeleteUpload管理
+		Owner          string          // 写入元数据文件的上传者标识
+		Language       string          // Error.FriendlyText使用的语言，如LangZH、LangEN，留空则使用中文
 		Request        *http.Request
 	}
 	// 错误类型
 	Error struct {
-		Status        int    // HTTP状态码
-		OriginalError error  // 原始的错误
-		FriendlyText  string // 错误文本
+		Code          ErrorCode // 错误代码
+		Status        int       // HTTP状态码
+		OriginalError error     // 原始的错误
+		FriendlyText  string    // 错误文本，使用Language对应的语言
 	}
 	// Result 上传结果
 	Result struct {
-		FileSize   int64  // 文件大小
-		FileMIME   string // 文件的MIME值
-		FileName   string // 上传后的文件完整路径
-		FileSuffix string // 上传后的文件后缀名
+		FieldName    string          `json:"field_name"`          // 上传控件的name值
+		OriginalName string          `json:"original_name"`       // 客户端提交的原始文件名
+		FileSize     int64           `json:"file_size"`           // 文件大小
+		FileMIME     string          `json:"file_mime"`           // 文件的MIME值（按文件内容识别）
+		FileName     string          `json:"file_name"`           // 上传后的文件名（相对SaveSubPath，分级存储时包含目录）
+		FileSuffix   string          `json:"file_suffix"`         // 上传后的文件后缀名
+		URL          string          `json:"url,omitempty"`       // 文件的访问地址，由存储后端生成
+		SHA256       string          `json:"sha256"`              // 文件内容的SHA-256值（hex）
+		Duplicate    bool            `json:"duplicate"`           // 存储中已存在相同内容的文件，本次未重复写入
+		Width        int             `json:"width,omitempty"`     // 图片宽度（像素），仅在启用图片处理时有值
+		Height       int             `json:"height,omitempty"`    // 图片高度（像素），仅在启用图片处理时有值
+		Variants     []Variant       `json:"variants,omitempty"`  // 生成的缩略图
+		Extracted    []ExtractedFile `json:"extracted,omitempty"` // 从压缩包中解压出的文件
 	}
 	// _sizeInterface 文件大小
 	_sizeInterface interface {
@@ -44,24 +86,128 @@ type (
 	_statInterface interface {
 		Stat() (os.FileInfo, error)
 	}
+	// source 待保存的文件
+	source struct {
+		reader    io.Reader
+		fieldName string               // 上传控件的name值
+		fileName  string               // 客户端提交的文件名
+		header    textproto.MIMEHeader // 文件的头信息
+		size      int64                // 文件大小，-1表示未知
+	}
 )
 
-// Exec 执行上传
+// Exec 执行上传，客户端断开连接时中止上传
 func (obj *Uploader) Exec() (result Result, execErr Error) {
-	var (
-		statInterface _statInterface
-		sizeInterface _sizeInterface
-		fileInfo      os.FileInfo
-		newFile       *os.File
-		ok            bool
-	)
+	return obj.ExecContext(obj.Request.Context())
+}
+
+// ExecContext 执行上传，ctx结束或超过WriteTimeout时中止复制数据，不会留下不完整的文件，
+// 返回的Error.OriginalError为ctx.Err()或context.DeadlineExceeded
+func (obj *Uploader) ExecContext(ctx context.Context) (result Result, execErr Error) {
+	if execErr = obj.limitRequest(); execErr.Status != 0 {
+		return
+	}
 
 	// 获得上传文件的数据
 	multipartFile, head, err := obj.Request.FormFile(obj.FieldName)
 	if err != nil {
-		execErr.FriendlyText = "无法获得要上传的文件数据"
-		execErr.OriginalError = err
-		execErr.Status = 400
+		if execErr = obj.copyError(err, 0); execErr.Status == 0 {
+			execErr = obj.newError(ErrNoFile, 400, err)
+		}
+		return
+	}
+	defer func() {
+		if err = multipartFile.Close(); err != nil {
+
+		}
+	}()
+
+	result, execErr = obj.saveMultipartFile(ctx, obj.FieldName, multipartFile, head, obj.SaveName)
+	result.FieldName = obj.FieldName
+	return
+}
+
+// ExecAll 执行多文件上传，依次处理fieldNames（留空则使用FieldName）下的所有文件
+// results和fileErrs按文件顺序一一对应，fileErrs[i].Status为0表示该文件上传成功
+// execErr表示整体性的错误（如无法解析表单、总大小超出限制），此时不会保存任何文件
+func (obj *Uploader) ExecAll(fieldNames ...string) (results []Result, fileErrs []Error, execErr Error) {
+	type upload struct {
+		fieldName string
+		head      *multipart.FileHeader
+		err       Error
+	}
+	var (
+		uploads   []upload
+		totalSize int64
+	)
+
+	if len(fieldNames) == 0 {
+		fieldNames = []string{obj.FieldName}
+	}
+
+	// 解析表单
+	if obj.Request.MultipartForm == nil {
+		if execErr = obj.limitRequest(); execErr.Status != 0 {
+			return
+		}
+		if err := obj.Request.ParseMultipartForm(defaultMaxMemory); err != nil {
+			if execErr = obj.copyError(err, 0); execErr.Status == 0 {
+				execErr = obj.newError(ErrNoFile, 400, err)
+			}
+			return
+		}
+	}
+	// 在写入任何文件之前校验文件数量、文件名和文件大小
+	for k := range fieldNames {
+		heads := obj.Request.MultipartForm.File[fieldNames[k]]
+		if execErr = obj.checkCount(fieldNames[k], len(heads)); execErr.Status != 0 {
+			return
+		}
+		rule := obj.rule(fieldNames[k])
+		for i := range heads {
+			uploads = append(uploads, upload{
+				fieldName: fieldNames[k],
+				head:      heads[i],
+				err:       obj.checkFile(rule, heads[i].Filename, heads[i].Size),
+			})
+			totalSize += heads[i].Size
+		}
+	}
+	if len(uploads) == 0 {
+		execErr = obj.newError(ErrNoFile, 400, http.ErrMissingFile)
+		return
+	}
+
+	// 判断文件总大小
+	if obj.MaxTotalSize > 0 && totalSize > obj.MaxTotalSize*1024 {
+		execErr = obj.newError(ErrTotalSizeExceeded, 413, errors.New("文件总大小("+strconv.FormatInt(totalSize, 10)+")超出限制("+strconv.FormatInt(obj.MaxTotalSize, 10)+")"))
+		return
+	}
+
+	results = make([]Result, len(uploads))
+	fileErrs = make([]Error, len(uploads))
+	for k := range uploads {
+		saveName := obj.SaveName
+		if saveName != "" && k > 0 {
+			saveName += "_" + strconv.Itoa(k)
+		}
+		if uploads[k].err.Status != 0 {
+			results[k].OriginalName = uploads[k].head.Filename
+			fileErrs[k] = uploads[k].err
+		} else {
+			results[k], fileErrs[k] = obj.saveFileHeader(obj.Request.Context(), uploads[k].fieldName, uploads[k].head, saveName)
+		}
+		results[k].FieldName = uploads[k].fieldName
+	}
+	return
+}
+
+// saveFileHeader 打开表单中的文件并保存
+func (obj *Uploader) saveFileHeader(ctx context.Context, fieldName string, head *multipart.FileHeader, saveName string) (result Result, execErr Error) {
+	multipartFile, err := head.Open()
+	if err != nil {
+		result.OriginalName = head.Filename
+		execErr = obj.newError(ErrNoFile, 400, err)
 		return
 	}
 	defer func() {
@@ -69,46 +215,102 @@ func (obj *Uploader) Exec() (result Result, execErr Error) {
 
 		}
 	}()
+	return obj.saveMultipartFile(ctx, fieldName, multipartFile, head, saveName)
+}
+
+// saveMultipartFile 获得表单中文件的大小并保存
+func (obj *Uploader) saveMultipartFile(ctx context.Context, fieldName string, multipartFile multipart.File, head *multipart.FileHeader, saveName string) (result Result, execErr Error) {
+	var (
+		statInterface _statInterface
+		sizeInterface _sizeInterface
+		fileInfo      os.FileInfo
+		fileSize      int64
+		ok            bool
+		err           error
+	)
 
 	// 获得文件大小
 	if statInterface, ok = multipartFile.(_statInterface); ok {
 		fileInfo, err = statInterface.Stat()
 		if err != nil {
-			execErr.FriendlyText = "无法获得要上传的文件大小"
-			execErr.OriginalError = err
-			execErr.Status = 400
+			result.OriginalName = head.Filename
+			execErr = obj.newError(ErrReadFailed, 400, err)
 			return
 		}
-		result.FileSize = fileInfo.Size()
+		fileSize = fileInfo.Size()
 	}
-	if result.FileSize == 0 {
+	if fileSize == 0 {
 		if sizeInterface, ok = multipartFile.(_sizeInterface); ok {
-			result.FileSize = sizeInterface.Size()
+			fileSize = sizeInterface.Size()
 		}
 	}
 
-	// 判断文件大小
-	if result.FileSize == 0 {
-		err = errors.New("文件大小为0")
-		execErr.FriendlyText = err.Error()
-		execErr.OriginalError = err
-		execErr.Status = 400
+	return obj.save(ctx, source{
+		reader:    multipartFile,
+		fieldName: fieldName,
+		fileName:  head.Filename,
+		header:    head.Header,
+		size:      fileSize,
+	}, saveName)
+}
+
+// save 校验并保存单个文件
+func (obj *Uploader) save(ctx context.Context, src source, saveName string) (result Result, execErr Error) {
+	var (
+		ok  bool
+		err error
+	)
+
+	if obj.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, obj.WriteTimeout)
+		defer cancel()
+	}
+
+	result.FieldName = src.fieldName
+	result.OriginalName = src.fileName
+	result.FileSize = src.size
+
+	// 判断文件名和文件大小，大小未知时在复制数据的过程中判断
+	rule := obj.rule(src.fieldName)
+	if execErr = obj.checkFile(rule, src.fileName, src.size); execErr.Status != 0 {
 		return
 	}
+	maxBytes := obj.maxBytes(rule)
+	reader := &sizeLimitReader{
+		reader: &contextReader{ctx: ctx, reader: src.reader},
+		limit:  maxBytes,
+		min:    rule.MinSize,
+		err:    errSizeExceeded,
+	}
 
-	if result.FileSize > obj.MaxSize*1024 {
-		execErr.FriendlyText = "文件大小超出限制"
-		execErr.OriginalError = errors.New("文件大小(" + strconv.FormatInt(result.FileSize, 10) + ")超出限制(" + strconv.FormatInt(obj.MaxSize, 10) + ")")
-		execErr.Status = 400
+	// 读取文件头部数据，识别文件的真实类型
+	sniffData := make([]byte, sniffLen)
+	n, err := io.ReadFull(reader, sniffData)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			err = errors.New("文件大小为0")
+			execErr = obj.newError(ErrEmptyFile, 400, err)
+			return
+		}
+		execErr = obj.copyError(err, maxBytes)
+		if execErr.Status == 0 {
+			execErr = obj.newError(ErrReadFailed, 400, err)
+		}
+		return
+	}
+	sniffData = sniffData[:n]
+	sniffed := DetectMIME(sniffData)
+	declared := src.header.Get("Content-Type")
+	result.FileMIME, ok = verifyMIME(sniffed, declared, filepath.Ext(src.fileName))
+	if !ok {
+		execErr = obj.newError(ErrMIMEMismatch, 415, errors.New("文件内容("+sniffed+")与声明的类型("+declared+")或文件名("+src.fileName+")不符"))
 		return
 	}
 
 	// 判断文件MIME值
-	result.FileMIME = head.Header.Get("Content-Type")
-	if !inStr(obj.AllowMIME, result.FileMIME) {
-		execErr.FriendlyText = "不允许上传该类型的文件"
-		execErr.OriginalError = errors.New("不允许上传" + result.FileMIME + "类型的文件")
-		execErr.Status = 400
+	if !obj.allowMIME(rule, result.FileMIME) {
+		execErr = obj.newError(ErrMIMERejected, 400, errors.New("不允许上传"+result.FileMIME+"类型的文件"))
 		return
 	}
 
@@ -117,51 +319,176 @@ func (obj *Uploader) Exec() (result Result, execErr Error) {
 		result.FileSuffix = obj.SaveSuffix
 	} else {
 		// 获得原始文件的后缀名
-		pos := strings.LastIndex(head.Filename, ".")
-		if pos != 0 {
-			result.FileSuffix = head.Filename[pos+1:]
+		result.FileSuffix = fileSuffix(src.fileName, result.FileMIME)
+	}
+
+	// 边复制数据边计算SHA-256
+	hash := encrypt.NewSHA256()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(sniffData), reader), hash)
+	info := NameInfo{
+		OriginalName: src.fileName,
+		MIME:         result.FileMIME,
+		Suffix:       result.FileSuffix,
+	}
+
+	// 按文件内容命名、需要处理图片或扫描病毒时，先将数据写入临时文件并计算SHA-256
+	var (
+		spoolFile *os.File
+		img       processedImage
+	)
+	hashName := saveName == "" && obj.NameStrategy == NameHash
+	imageEnabled := obj.Image != nil && isImageMIME(result.FileMIME)
+	extractEnabled := obj.Extract != nil && isArchiveMIME(result.FileMIME)
+	if hashName || imageEnabled || extractEnabled || obj.Scanner != nil {
+		spoolFile, result.SHA256, err = obj.spool(body)
+		if err != nil {
+			if execErr = obj.copyError(err, maxBytes); execErr.Status != 0 {
+				return
+			}
+			execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("写入临时文件失败: %w", err))
+			return
+		}
+		defer closeSpool(spoolFile)
+		body = spoolFile
+		result.FileSize = reader.n
+	}
+
+	// 扫描病毒
+	if obj.Scanner != nil {
+		if execErr = obj.scan(spoolFile, &result); execErr.Status != 0 {
+			return
 		}
 	}
 
-	// 如果文件名没有指定,则使用原始文件名
-	if obj.SaveName == "" {
-		obj.SaveName = head.Filename
+	// 图片处理
+	if imageEnabled {
+		if img, execErr = obj.processImage(spoolFile, result.FileMIME); execErr.Status != 0 {
+			return
+		}
+		result.Width, result.Height = img.width, img.height
+		if img.file != nil {
+			// 使用重新编码后的原图
+			defer closeSpool(img.file)
+			body = img.file
+			result.SHA256 = img.sha256
+			result.FileSize = img.size
+		} else if _, err = spoolFile.Seek(0, io.SeekStart); err != nil {
+			execErr = obj.newError(ErrStorageFailed, 500, err)
+			return
+		}
+	}
+	if hashName {
+		info.SHA256 = result.SHA256
 	}
 
-	// 递归创建目录
-	savePath := filepath.Clean(obj.SaveRootPath + "/" + obj.SaveSubPath)
-	err = os.MkdirAll(savePath, obj.DirPermission)
+	// 如果文件名没有指定,则按NameStrategy生成
+	if saveName == "" {
+		if saveName, err = obj.makeName(info); err != nil {
+			execErr = obj.newError(ErrStorageFailed, 500, err)
+			return
+		}
+	}
+	name, err := safeName(obj.SaveSubPath, saveName, result.FileSuffix)
 	if err != nil {
-		execErr.FriendlyText = "创建目录失败"
-		execErr.OriginalError = errors.New("创建目录失败 " + savePath)
-		execErr.Status = 500
+		execErr = obj.newError(ErrInvalidPath, 400, err)
 		return
 	}
-	// 在指定的路径创建文件
-	filePath := filepath.Clean(obj.SaveRootPath + "/" + obj.SaveSubPath + "/" + obj.SaveName + "." + result.FileSuffix)
-	newFile, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, obj.FilePermission)
+
+	result.FileName = relativeName(saveName, result.FileSuffix)
+
+	// 按内容命名时，存储中已存在的同名文件即为相同内容的文件
+	storage := obj.storage()
+	if info.SHA256 != "" && obj.Deduplicate {
+		if result.Duplicate, err = storage.Exists(name); err != nil {
+			execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("检查文件是否存在失败 %s: %w", name, err))
+			return
+		}
+		if result.Duplicate {
+			result.URL = storage.URL(name)
+			result.Variants, _ = obj.putThumbnails(storage, saveName, result.FileSuffix, result.FileMIME, img.thumbnails, false)
+			return
+		}
+	}
+
+	// 存在同名文件时自动重命名
+	if obj.Overwrite == OverwriteRename {
+		if name, saveName, err = obj.availableName(storage, saveName, result.FileSuffix); err != nil {
+			execErr = obj.newError(ErrStorageFailed, 500, err)
+			return
+		}
+		result.FileName = relativeName(saveName, result.FileSuffix)
+	}
+
+	// 解压压缩包，压缩包本身写入失败时删除已解压的文件
+	var extractedNames []string
+	if extractEnabled {
+		if result.Extracted, extractedNames, execErr = obj.extract(ctx, storage, rule, spoolFile, result.OriginalName, result.FileMIME, result.FileSize); execErr.Status != 0 {
+			return
+		}
+		defer func() {
+			if execErr.Status != 0 {
+				for k := range extractedNames {
+					_ = storage.Delete(extractedNames[k])
+				}
+				result.Extracted = nil
+			}
+		}()
+		if _, err = spoolFile.Seek(0, io.SeekStart); err != nil {
+			execErr = obj.newError(ErrStorageFailed, 500, err)
+			return
+		}
+	}
+
+	// 写入存储后端
+	body = &contextReader{ctx: ctx, reader: obj.wrapProgress(ctx, body, result.OriginalName, result.FileSize)}
+	err = storage.Put(name, body, PutOptions{
+		Size:        result.FileSize,
+		MIME:        result.FileMIME,
+		NoOverwrite: obj.Overwrite != OverwriteReplace,
+	})
 	if err != nil {
-		execErr.FriendlyText = "上传文件失败"
-		execErr.OriginalError = errors.New("创建文件失败 " + filePath)
-		execErr.Status = 500
+		if execErr = obj.copyError(err, maxBytes); execErr.Status != 0 {
+			return
+		}
+		if errors.Is(err, os.ErrExist) {
+			execErr = obj.newError(ErrFileExists, 409, fmt.Errorf("文件已存在 %s: %w", name, err))
+			return
+		}
+		execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("写入文件失败 %s: %w", name, err))
 		return
 	}
-	defer func() {
-		if err = newFile.Close(); err != nil {
-		}
-	}()
+	if spoolFile == nil {
+		result.FileSize = reader.n
+	}
+	result.URL = storage.URL(name)
 
-	// 复制数据到文件
-	if _, err = io.Copy(newFile, multipartFile); err != nil {
-		execErr.FriendlyText = "上传文件失败"
-		execErr.OriginalError = errors.New("复制上传数据到文件失败 " + filePath)
-		execErr.Status = 500
+	// 写入缩略图前确认上传未被中止
+	if err = ctx.Err(); err != nil {
+		_ = storage.Delete(name)
+		execErr = obj.copyError(err, maxBytes)
+		return
+	}
+	if result.Variants, err = obj.putThumbnails(storage, saveName, result.FileSuffix, result.FileMIME, img.thumbnails, true); err != nil {
+		_ = storage.Delete(name)
+		execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("写入缩略图失败: %w", err))
 		return
 	}
+	if result.SHA256 == "" {
+		result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
 
-	// 返回文件路径
-	// result.FileName = obj.SaveSubPath + "/" + obj.SaveName + fileExt
-	result.FileName = obj.SaveName + "." + result.FileSuffix
+	// 写入元数据文件，失败时删除文件和缩略图
+	if obj.WriteMetadata {
+		if err = obj.putMetadata(storage, name, &result); err != nil {
+			variantNames := obj.variantNames(result.Variants)
+			for k := range variantNames {
+				_ = storage.Delete(variantNames[k])
+			}
+			_ = storage.Delete(name)
+			execErr = obj.newError(ErrStorageFailed, 500, fmt.Errorf("写入元数据失败 %s: %w", name, err))
+			return
+		}
+	}
 	return
 }
 
@@ -0,0 +1,402 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dxvgef/gommon/uploader/uploadertest"
+)
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *http.Request
+		prepare func(obj *Uploader)
+		code    ErrorCode // 0表示应上传成功
+		status  int
+		check   func(t *testing.T, storage *MemoryStorage, result Result)
+	}{
+		{
+			name:    "文本文件",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello world")),
+			check: func(t *testing.T, storage *MemoryStorage, result Result) {
+				if data, ok := storage.Get("sub/" + result.FileName); !ok || string(data) != "hello world" {
+					t.Fatalf("文件写入不正确: %q", data)
+				}
+				if result.FieldName != "file" || result.OriginalName != "a.txt" || result.FileSize != 11 || result.FileMIME != "text/plain" {
+					t.Fatalf("上传结果不正确: %+v", result)
+				}
+				if result.SHA256 != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+					t.Fatal("SHA256不正确", result.SHA256)
+				}
+			},
+		},
+		{
+			name:    "图片",
+			request: uploadertest.NewRequest("/", uploadertest.PNG("file", "a.png", 20, 10)),
+			prepare: func(obj *Uploader) {
+				obj.Image = &ImageOptions{MaxWidth: 100}
+			},
+			check: func(t *testing.T, storage *MemoryStorage, result Result) {
+				if result.FileMIME != "image/png" || result.Width != 20 || result.Height != 10 {
+					t.Fatalf("上传结果不正确: %+v", result)
+				}
+			},
+		},
+		{
+			name:    "没有文件",
+			request: uploadertest.NewRequest("/", uploadertest.Text("other", "a.txt", "hello")),
+			code:    ErrNoFile,
+			status:  400,
+		},
+		{
+			name:    "空文件",
+			request: uploadertest.NewRequest("/", uploadertest.Empty("file", "a.txt")),
+			code:    ErrEmptyFile,
+			status:  400,
+		},
+		{
+			name:    "文件过大",
+			request: uploadertest.NewRequest("/", uploadertest.Sized("file", "a.txt", 2048, 'a')),
+			code:    ErrSizeExceeded,
+			status:  413,
+		},
+		{
+			name:    "请求过大",
+			request: uploadertest.NewRequest("/", uploadertest.Sized("file", "a.txt", 512, 'a')),
+			prepare: func(obj *Uploader) {
+				obj.MaxRequestSize = 256
+			},
+			code:   ErrRequestSizeExceeded,
+			status: 413,
+		},
+		{
+			name: "伪造Content-Type",
+			request: uploadertest.NewRequest("/", uploadertest.File{
+				FieldName:   "file",
+				FileName:    "a.txt",
+				ContentType: "image/png",
+				Content:     strings.NewReader("hello world"),
+			}),
+			code:   ErrMIMEMismatch,
+			status: 415,
+		},
+		{
+			name:    "文件内容与扩展名不符",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.png", "hello world")),
+			code:    ErrMIMEMismatch,
+			status:  415,
+		},
+		{
+			name: "HTML文件声明为文本",
+			request: uploadertest.NewRequest("/", uploadertest.File{
+				FieldName:   "file",
+				FileName:    "x.html",
+				ContentType: "text/plain",
+				Content:     strings.NewReader("<img src=x onerror=alert(document.cookie)>"),
+			}),
+			prepare: func(obj *Uploader) {
+				obj.AllowMIME = []string{"text/plain"}
+			},
+			code:   ErrMIMERejected,
+			status: 400,
+		},
+		{
+			name: "SVG文件声明为文本",
+			request: uploadertest.NewRequest("/", uploadertest.File{
+				FieldName:   "file",
+				FileName:    "y.svg",
+				ContentType: "text/plain",
+				Content:     strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`),
+			}),
+			prepare: func(obj *Uploader) {
+				obj.AllowMIME = []string{"text/plain"}
+			},
+			code:   ErrMIMERejected,
+			status: 400,
+		},
+		{
+			name:    "HTML内容使用文本扩展名",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "<script>alert(1)</script>")),
+			code:    ErrMIMEMismatch,
+			status:  415,
+		},
+		{
+			name: "声明的类型不能改变文本格式",
+			request: uploadertest.NewRequest("/", uploadertest.File{
+				FieldName:   "file",
+				FileName:    "a.txt",
+				ContentType: "text/html",
+				Content:     strings.NewReader("hello world"),
+			}),
+			check: func(t *testing.T, storage *MemoryStorage, result Result) {
+				if result.FileMIME != "text/plain" {
+					t.Fatal("MIME值应为text/plain", result.FileMIME)
+				}
+			},
+		},
+		{
+			name:    "SVG文件",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "y.svg", `<svg xmlns="http://www.w3.org/2000/svg"/>`)),
+			prepare: func(obj *Uploader) {
+				obj.AllowMIME = []string{"image/svg+xml"}
+			},
+			check: func(t *testing.T, storage *MemoryStorage, result Result) {
+				if result.FileMIME != "image/svg+xml" || result.FileSuffix != "svg" {
+					t.Fatalf("上传结果不正确: %+v", result)
+				}
+			},
+		},
+		{
+			name:    "不允许的类型",
+			request: uploadertest.NewRequest("/", uploadertest.PNG("file", "a.png", 1, 1)),
+			prepare: func(obj *Uploader) {
+				obj.AllowMIME = []string{"text/plain"}
+			},
+			code:   ErrMIMERejected,
+			status: 400,
+		},
+		{
+			name:    "不允许的扩展名",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello")),
+			prepare: func(obj *Uploader) {
+				obj.Rules = map[string]Rule{"file": {DenyExt: []string{"TXT"}}}
+			},
+			code:   ErrExtRejected,
+			status: 400,
+		},
+		{
+			name:    "元数据文件名",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "victim.txt.META.json", `{"file_mime":"text/html"}`)),
+			prepare: func(obj *Uploader) {
+				obj.AllowMIME = []string{"text/plain", "application/json"}
+				obj.WriteMetadata = true
+			},
+			code:   ErrInvalidPath,
+			status: 400,
+		},
+		{
+			name:    "文件已存在",
+			request: uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", "hello")),
+			prepare: func(obj *Uploader) {
+				obj.SaveName = "exists"
+				obj.Overwrite = OverwriteFail
+				_ = obj.Storage.Put("sub/exists.txt", strings.NewReader("old"), PutOptions{Size: 3})
+			},
+			code:   ErrFileExists,
+			status: 409,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &MemoryStorage{}
+			obj := Uploader{
+				FieldName:   "file",
+				MaxSize:     1,
+				AllowMIME:   []string{"text/plain", "image/png"},
+				SaveSubPath: "sub",
+				Storage:     storage,
+				Request:     tt.request,
+			}
+			if tt.prepare != nil {
+				tt.prepare(&obj)
+			}
+			result, execErr := obj.Exec()
+			if tt.code == 0 {
+				if execErr.Status != 0 {
+					t.Fatal(execErr)
+				}
+				if tt.check != nil {
+					tt.check(t, storage, result)
+				}
+				return
+			}
+			if !errors.Is(execErr, tt.code) || execErr.Status != tt.status {
+				t.Fatalf("应返回%d(%d)，实际为%d(%d): %v", tt.code, tt.status, execErr.Code, execErr.Status, execErr)
+			}
+		})
+	}
+}
+
+func TestExecAllTotalSize(t *testing.T) {
+	storage := &MemoryStorage{}
+	obj := Uploader{
+		FieldName:    "file",
+		MaxSize:      1,
+		MaxTotalSize: 1,
+		AllowMIME:    []string{"text/plain"},
+		Storage:      storage,
+		Request: uploadertest.NewRequest("/",
+			uploadertest.Sized("file", "a.txt", 600, 'a'),
+			uploadertest.Sized("file", "b.txt", 600, 'b'),
+		),
+	}
+	_, _, execErr := obj.ExecAll()
+	// 与流式上传时超出总大小的状态码一致
+	if !errors.Is(execErr, ErrTotalSizeExceeded) || execErr.Status != 413 {
+		t.Fatalf("应返回%d(413)，实际为%d(%d): %v", ErrTotalSizeExceeded, execErr.Code, execErr.Status, execErr)
+	}
+	if names, _ := storage.List(""); len(names) > 0 {
+		t.Fatal("不应写入文件", names)
+	}
+}
+
+// cancelStorage 读取部分数据后调用cancel，模拟复制数据的过程中客户端断开或超时
+type cancelStorage struct {
+	*MemoryStorage
+	cancel func()
+}
+
+func (s cancelStorage) Put(name string, r io.Reader, opts PutOptions) error {
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != nil {
+		return err
+	}
+	s.cancel()
+	return s.MemoryStorage.Put(name, r, opts)
+}
+
+func TestExecContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(obj *Uploader) context.Context
+		code    ErrorCode
+		status  int
+	}{
+		{
+			name: "已取消",
+			prepare: func(obj *Uploader) context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			code:   ErrCanceled,
+			status: 499,
+		},
+		{
+			name: "复制数据时取消",
+			prepare: func(obj *Uploader) context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				obj.Storage = cancelStorage{MemoryStorage: obj.Storage.(*MemoryStorage), cancel: cancel}
+				return ctx
+			},
+			code:   ErrCanceled,
+			status: 499,
+		},
+		{
+			name: "已超时",
+			prepare: func(obj *Uploader) context.Context {
+				ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+				defer cancel()
+				return ctx
+			},
+			code:   ErrTimeout,
+			status: 408,
+		},
+		{
+			name: "超过WriteTimeout",
+			prepare: func(obj *Uploader) context.Context {
+				obj.WriteTimeout = time.Nanosecond
+				return context.Background()
+			},
+			code:   ErrTimeout,
+			status: 408,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "uploader")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			storage := &MemoryStorage{}
+			obj := Uploader{
+				FieldName: "file",
+				MaxSize:   1,
+				AllowMIME: []string{"text/plain"},
+				TempPath:  root,
+				Storage:   storage,
+				Request:   uploadertest.NewRequest("/", uploadertest.Sized("file", "a.txt", 1000, 'a')),
+			}
+			ctx := tt.prepare(&obj)
+			_, execErr := obj.ExecContext(ctx)
+			if !errors.Is(execErr, tt.code) || execErr.Status != tt.status {
+				t.Fatalf("应返回%d(%d)，实际为%d(%d): %v", tt.code, tt.status, execErr.Code, execErr.Status, execErr)
+			}
+			if names, _ := storage.List(""); len(names) > 0 {
+				t.Fatal("不应写入文件", names)
+			}
+			if names := dirNames(t, root); len(names) > 0 {
+				t.Fatal("不应留下临时文件", names)
+			}
+		})
+	}
+}
+
+// countStorage 记录写入文件的次数
+type countStorage struct {
+	*MemoryStorage
+	puts *int
+}
+
+func (s countStorage) Put(name string, r io.Reader, opts PutOptions) error {
+	*s.puts++
+	return s.MemoryStorage.Put(name, r, opts)
+}
+
+func TestExecDeduplicate(t *testing.T) {
+	storage := &MemoryStorage{}
+	var puts int
+	upload := func(content string) Result {
+		obj := Uploader{
+			FieldName:    "file",
+			MaxSize:      1,
+			AllowMIME:    []string{"text/plain"},
+			SaveSubPath:  "sub",
+			NameStrategy: NameHash,
+			HashShard:    2,
+			Deduplicate:  true,
+			Storage:      countStorage{MemoryStorage: storage, puts: &puts},
+			Request:      uploadertest.NewRequest("/", uploadertest.Text("file", "a.txt", content)),
+		}
+		result, execErr := obj.Exec()
+		if execErr.Status != 0 {
+			t.Fatal(execErr)
+		}
+		return result
+	}
+
+	const hash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	// 按哈希值分级存储
+	result := upload("hello world")
+	if result.Duplicate || result.SHA256 != hash || result.FileName != "b9/4d/"+hash+".txt" {
+		t.Fatalf("上传结果不正确: %+v", result)
+	}
+	if data, ok := storage.Get("sub/b9/4d/" + hash + ".txt"); !ok || string(data) != "hello world" {
+		t.Fatalf("文件写入不正确: %q", data)
+	}
+
+	// 相同内容的文件跳过写入
+	duplicate := upload("hello world")
+	if !duplicate.Duplicate || duplicate.SHA256 != hash || duplicate.FileName != result.FileName || duplicate.FileSize != 11 {
+		t.Fatalf("上传结果不正确: %+v", duplicate)
+	}
+	if puts != 1 {
+		t.Fatal("相同内容的文件不应重复写入", puts)
+	}
+
+	// 不同内容的文件
+	if result = upload("hello"); result.Duplicate || result.FileName == duplicate.FileName {
+		t.Fatalf("上传结果不正确: %+v", result)
+	}
+	if names, _ := storage.List(""); len(names) != 2 || puts != 2 {
+		t.Fatal("应写入2个文件", names)
+	}
+}
@@ -0,0 +1,130 @@
+// Package uploadertest 提供测试上传功能时构造multipart请求的工具函数
+package uploadertest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+)
+
+// File 请求中的一个文件
+type File struct {
+	FieldName   string               // 上传控件的name值
+	FileName    string               // 客户端提交的文件名
+	ContentType string               // 客户端声明的Content-Type，留空则使用application/octet-stream，可用于伪造类型
+	Header      textproto.MIMEHeader // 附加的头信息，优先于FileName和ContentType生成的头信息
+	Content     io.Reader            // 文件数据，为nil则为空文件
+}
+
+// Bytes 使用[]byte作为文件数据
+func Bytes(fieldName, fileName string, data []byte) File {
+	return File{FieldName: fieldName, FileName: fileName, Content: bytes.NewReader(data)}
+}
+
+// Text 使用字符串作为文件数据，ContentType为text/plain
+func Text(fieldName, fileName, text string) File {
+	return File{FieldName: fieldName, FileName: fileName, ContentType: "text/plain; charset=utf-8", Content: strings.NewReader(text)}
+}
+
+// Empty 大小为0的文件
+func Empty(fieldName, fileName string) File {
+	return File{FieldName: fieldName, FileName: fileName}
+}
+
+// Sized 指定大小的文件，数据为重复的字节c，可用于构造超出大小限制的文件
+func Sized(fieldName, fileName string, size int64, c byte) File {
+	return File{FieldName: fieldName, FileName: fileName, Content: io.LimitReader(repeatReader(c), size)}
+}
+
+// PNG 指定尺寸的PNG图片
+func PNG(fieldName, fileName string, width, height int) File {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return File{FieldName: fieldName, FileName: fileName, ContentType: "image/png", Content: &buf}
+}
+
+// Body 构造multipart请求体，返回请求体和Content-Type，values为普通的表单字段
+func Body(values map[string]string, files ...File) (*bytes.Buffer, string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range values {
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, "", err
+		}
+	}
+	for k := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(files[k].FieldName), escapeQuotes(files[k].FileName)))
+		contentType := files[k].ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+		for name, values := range files[k].Header {
+			header[name] = values
+		}
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if files[k].Content != nil {
+			if _, err = io.Copy(w, files[k].Content); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, mw.FormDataContentType(), nil
+}
+
+// NewRequest 构造上传文件的POST请求，出错时panic，适用于httptest风格的测试代码
+func NewRequest(target string, files ...File) *http.Request {
+	return NewFormRequest(http.MethodPost, target, nil, files...)
+}
+
+// NewFormRequest 构造包含普通表单字段和文件的请求，出错时panic
+func NewFormRequest(method, target string, values map[string]string, files ...File) *http.Request {
+	body, contentType, err := Body(values, files...)
+	if err != nil {
+		panic(err)
+	}
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+// repeatReader 无限重复同一个字节的Reader
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes 与mime/multipart相同的转义规则
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}